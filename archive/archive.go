@@ -0,0 +1,207 @@
+// Package archive manages a local directory of downloaded episodes.
+//
+// An archive is a plain directory with an index file, index.json, which records every downloaded episode:
+//
+//	~/radio
+//	├── index.json
+//	├── fujita-3919.mp4
+//	└── gurepap-3897.m4a
+//
+// The index keeps the size and checksum of each file, so that an episode can be verified before it is skipped by
+// later downloads.
+package archive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const IndexFile = "index.json"
+
+// Represents an archived episode.
+type Entry struct {
+	Id      int       `json:"id"`
+	RadioId int       `json:"radio_id"`
+	Radio   string    `json:"radio"`
+	Title   string    `json:"title"`
+	Date    time.Time `json:"date"`
+	// Relative to the archive directory, unless the file is outside of it.
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256"`
+	// When the episode was added to the archive
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+type Library struct {
+	dir     string
+	entries map[int]Entry
+}
+
+// Opens the archive at dir, the directory is created if it doesn't exist.
+func Open(dir string) (*Library, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	l := &Library{
+		dir:     dir,
+		entries: make(map[int]Entry),
+	}
+
+	b, err := os.ReadFile(l.index())
+	switch {
+	case os.IsNotExist(err):
+		return l, nil
+	case err != nil:
+		return nil, err
+	}
+
+	var entries []Entry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, fmt.Errorf("Open: %s: %w", l.index(), err)
+	}
+	for _, e := range entries {
+		l.entries[e.Id] = e
+	}
+	return l, nil
+}
+
+func (l *Library) Dir() string {
+	return l.dir
+}
+
+// Returns the entry of an episode, otherwise ok is set to false.
+func (l *Library) Get(id int) (e Entry, ok bool) {
+	e, ok = l.entries[id]
+	return
+}
+
+// Returns true if the episode is recorded and its file is there with the recorded size. It doesn't read the file,
+// use Verify() to compare the checksum.
+func (l *Library) Has(id int) bool {
+	e, ok := l.entries[id]
+	if !ok {
+		return false
+	}
+	fi, err := os.Stat(l.Abs(e))
+	return err == nil && fi.Size() == e.Size
+}
+
+// Checks the file of an archived episode against its recorded size and checksum.
+func (l *Library) Verify(id int) error {
+	e, ok := l.entries[id]
+	if !ok {
+		return fmt.Errorf("Verify: %d: not archived", id)
+	}
+
+	size, sum, err := checksum(l.Abs(e))
+	if err != nil {
+		return err
+	}
+	if size != e.Size || sum != e.Sha256 {
+		return fmt.Errorf("Verify: %s: mismatched size or checksum", e.Path)
+	}
+	return nil
+}
+
+// Records an episode whose file is at e.Path, and saves the index. Size and checksum are computed from the file.
+// An earlier entry of the same episode is replaced.
+func (l *Library) Add(e Entry) error {
+	size, sum, err := checksum(e.Path)
+	if err != nil {
+		return err
+	}
+	e.Size, e.Sha256 = size, sum
+
+	if rel, ok := l.rel(e.Path); ok {
+		e.Path = rel
+	}
+	if e.ArchivedAt.IsZero() {
+		e.ArchivedAt = time.Now()
+	}
+
+	l.entries[e.Id] = e
+	return l.Save()
+}
+
+// Removes an episode from the index and saves it, the file is left as is.
+func (l *Library) Remove(id int) error {
+	delete(l.entries, id)
+	return l.Save()
+}
+
+// Returns all the entries ordered by their ids.
+func (l *Library) Entries() []Entry {
+	out := make([]Entry, 0, len(l.entries))
+	for _, e := range l.entries {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Id < out[j].Id })
+	return out
+}
+
+// Returns the path to the file of an entry.
+func (l *Library) Abs(e Entry) string {
+	if filepath.IsAbs(e.Path) {
+		return e.Path
+	}
+	return filepath.Join(l.dir, e.Path)
+}
+
+// Writes the index, the old one is replaced only if the new one is completely written.
+func (l *Library) Save() error {
+	b, err := json.MarshalIndent(l.Entries(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := l.index() + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.index())
+}
+
+func (l *Library) index() string {
+	return filepath.Join(l.dir, IndexFile)
+}
+
+// Returns the path relative to the archive directory if the file is inside of it.
+func (l *Library) rel(path string) (string, bool) {
+	dir, err := filepath.Abs(l.dir)
+	if err != nil {
+		return "", false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(dir, abs)
+	if err != nil || rel == ".." || len(rel) > 2 && rel[:3] == ".."+string(filepath.Separator) {
+		return "", false
+	}
+	return rel, true
+}
+
+func checksum(path string) (size int64, sum string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err = io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
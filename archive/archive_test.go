@@ -0,0 +1,81 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLibrary(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		dir    = filepath.Join(t.TempDir(), "radio")
+		date   = time.Date(2021, 4, 9, 0, 0, 0, 0, time.FixedZone("UTC+9", 9*60*60))
+	)
+
+	l, err := Open(dir)
+	assert.NoError(err)
+	assert.Empty(l.Entries())
+	assert.False(l.Has(3919))
+	assert.EqualError(l.Verify(3919), "Verify: 3919: not archived")
+
+	{
+		path := filepath.Join(dir, "fujita-3919.mp4")
+		os.WriteFile(path, []byte("hello"), 0644)
+
+		assert.NoError(l.Add(Entry{Id: 3919, RadioId: 88, Radio: "fujita", Title: "第83回 予告", Date: date, Path: path}))
+		assert.True(l.Has(3919))
+		assert.NoError(l.Verify(3919))
+
+		e, ok := l.Get(3919)
+		assert.True(ok)
+		assert.Equal("fujita-3919.mp4", e.Path, "Path is relative to the archive")
+		assert.Equal(int64(5), e.Size)
+		assert.Equal("2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", e.Sha256)
+		assert.Equal(path, l.Abs(e))
+		assert.False(e.ArchivedAt.IsZero())
+	}
+	{
+		// Outside of the archive
+		path := filepath.Join(t.TempDir(), "gurepap-3897.m4a")
+		os.WriteFile(path, []byte("world"), 0644)
+
+		assert.NoError(l.Add(Entry{Id: 3897, Path: path}))
+		e, _ := l.Get(3897)
+		assert.Equal(path, e.Path)
+		assert.Equal(path, l.Abs(e))
+	}
+	{
+		// Reopen
+		l, err := Open(dir)
+		assert.NoError(err)
+		assert.Len(l.Entries(), 2)
+		assert.Equal(3897, l.Entries()[0].Id)
+
+		e, _ := l.Get(3919)
+		assert.True(date.Equal(e.Date))
+		assert.Equal("fujita", e.Radio)
+	}
+	{
+		// Same size, different content
+		os.WriteFile(filepath.Join(dir, "fujita-3919.mp4"), []byte("HELLO"), 0644)
+		assert.True(l.Has(3919))
+		assert.EqualError(l.Verify(3919), "Verify: fujita-3919.mp4: mismatched size or checksum")
+
+		os.Remove(filepath.Join(dir, "fujita-3919.mp4"))
+		assert.False(l.Has(3919))
+		assert.Error(l.Verify(3919))
+
+		assert.NoError(l.Remove(3919))
+		_, ok := l.Get(3919)
+		assert.False(ok)
+	}
+	{
+		os.WriteFile(filepath.Join(dir, IndexFile), []byte("{"), 0644)
+		_, err := Open(dir)
+		assert.Error(err)
+	}
+}
@@ -2,16 +2,23 @@ package cmd
 
 import (
 	"compress/bzip2"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/adios/onsengo/archive"
 	"github.com/adios/onsengo/onsen"
+	"github.com/adios/onsengo/onsen/nuxt"
+	"github.com/spf13/pflag"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -22,19 +29,69 @@ func TestMain(m *testing.M) {
 	root.out, root.err = new(strings.Builder), new(strings.Builder)
 	root.cmd.SetOut(root.out)
 	root.cmd.SetErr(root.err)
+	// Keep away from the user's config
+	dir, _ := os.MkdirTemp("", "onsengo")
+	os.Setenv("XDG_CONFIG_HOME", dir)
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, "ONSENGO_") {
+			os.Unsetenv(strings.SplitN(kv, "=", 2)[0])
+		}
+	}
 
-	os.Exit(m.Run())
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
 }
 
 type mockEpisode struct {
 	manifest string
 	tm       time.Time
+	title    string
+	guests   []string
+	premium  bool
+	video    bool
 }
 
 func (e mockEpisode) Id() int {
 	return 1227
 }
 
+func (e mockEpisode) RadioId() int {
+	return 88
+}
+
+func (e mockEpisode) Title() string {
+	return e.title
+}
+
+func (e mockEpisode) Guests() []onsen.Person {
+	out := make([]onsen.Person, len(e.guests))
+	for i, name := range e.guests {
+		out[i] = onsen.Person{Raw: &nuxt.Performer{Name: name}}
+	}
+	return out
+}
+
+func (e mockEpisode) RequiresPremium() bool {
+	return e.premium
+}
+
+func (e mockEpisode) IsBonus() bool {
+	return false
+}
+
+func (e mockEpisode) HasVideoStream() bool {
+	return e.video
+}
+
+func (e mockEpisode) IsLatest() bool {
+	return false
+}
+
+func (e mockEpisode) IsExpiring() bool {
+	return false
+}
+
 func (e mockEpisode) Manifest() (string, bool) {
 	if e.manifest == "" {
 		return "", false
@@ -84,6 +141,85 @@ func TestFilter(t *testing.T) {
 		f.Push(normal)
 		assert.Equal([]string{"b"}, f.Out())
 	}
+	{
+		f := NewFilter(FilterUpdatedBefore(pt("2021-06-04")))
+		f.Push(mockEpisode{manifest: "a", tm: pt("2021-06-03")})
+		f.Push(normal)
+		assert.Equal([]string{"a"}, f.Out())
+	}
+	{
+		f := NewFilter(FilterUpdatedOn(pt("2021-06-04").Add(time.Hour)))
+		f.Push(mockEpisode{manifest: "a", tm: pt("2021-06-03")})
+		f.Push(normal)
+		assert.Equal([]string{"b"}, f.Out())
+	}
+}
+
+func TestFilterWhere(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		pt     = func(str string) time.Time {
+			out, _ := time.ParseInLocation("2006-01-02", str, time.FixedZone("UTC+9", 9*60*60))
+			return out
+		}
+		a = mockEpisode{manifest: "a", tm: pt("2021-04-01"), title: "第1回", guests: []string{"日高里菜"}, video: true}
+		b = mockEpisode{manifest: "b", tm: pt("2021-03-31"), title: "第2回 おまけ", premium: true}
+		c = mockEpisode{manifest: "c", title: "特別編", guests: []string{"藤田茜", "日高里菜"}}
+	)
+
+	tests := []struct {
+		expr     string
+		expected []string
+	}{
+		{"video", []string{"a"}},
+		{"not video", []string{"b", "c"}},
+		{"premium=false and video", []string{"a"}},
+		{"PREMIUM != true", []string{"a", "c"}},
+		{"date>=2021-04-01", []string{"a"}},
+		{"date<2021-04-01 or date=2021-04-01", []string{"a", "b"}},
+		{`guest~"日高"`, []string{"a", "c"}},
+		{"guest~ひだか", []string{}},
+		{"guest=藤田茜", []string{"c"}},
+		{"guest!=藤田茜", []string{"a", "b"}},
+		{`title~"おまけ" or (id=1227 and not accessible)`, []string{"b"}},
+		{`title="第2回 おまけ"`, []string{"b"}},
+		{"id>=1227 and radio_id=88", []string{"a", "b", "c"}},
+		{"not (video or premium) or guest~藤田", []string{"c"}},
+	}
+	for _, test := range tests {
+		opt, err := FilterWhere(test.expr)
+		if !assert.NoError(err, test.expr) {
+			continue
+		}
+		f := NewFilter(opt)
+		f.Push(a)
+		f.Push(b)
+		f.Push(c)
+		assert.Equal(test.expected, f.Out(), test.expr)
+	}
+
+	errors := []struct {
+		expr     string
+		expected string
+	}{
+		{"", "at 1: empty expression"},
+		{"foo", `at 1: unknown field "foo", must be one of accessible, bonus, date, expiring, guest, id, latest, premium, radio_id, title, video`},
+		{"video and", "at 10: expected a field or \"(\""},
+		{"(video", `at 1: unclosed "("`},
+		{"video)", `at 6: unexpected ")"`},
+		{"title", `at 1: expected an operator after "title"`},
+		{"title<a", `at 6: "title" takes = != ~, not "<"`},
+		{"id=", `at 3: expected a value after "="`},
+		{"id=x", `at 4: "id" is a number, got "x"`},
+		{"date>=4/1", `at 7: "date" is a date in YYYY-MM-DD, got "4/1"`},
+		{"video=yes", `at 7: "video" is a bool, got "yes"`},
+		{`title~"a`, "at 7: unterminated string"},
+		{"video ! premium", `at 7: expected "!="`},
+	}
+	for _, test := range errors {
+		_, err := FilterWhere(test.expr)
+		assert.EqualError(err, test.expected, test.expr)
+	}
 }
 
 func TestUnique(t *testing.T) {
@@ -197,3 +333,1511 @@ func server(t *testing.T) http.Handler {
 		w.Write(data)
 	})
 }
+
+func TestGet(t *testing.T) {
+	type b = *strings.Builder
+
+	var (
+		assert = assert.New(t)
+		mux    = http.NewServeMux()
+		server = httptest.NewServer(mux)
+		dir    = t.TempDir()
+
+		execute = func(fn func(b, b), input ...string) {
+			out := root.out.(b)
+			err := root.err.(b)
+
+			// Every execution fetches the site again
+			root.oo = nil
+			root.lib = nil
+			// Flags stay given between executions
+			get.cmd.Flags().Lookup("dir").Changed = false
+			root.cmd.SetArgs(input)
+			fn(out, err)
+
+			out.Reset()
+			err.Reset()
+		}
+	)
+	defer server.Close()
+	defer func() { root.oo, root.lib, root.archive, root.session = nil, nil, "", "" }()
+
+	mux.HandleFunc("/{$}", func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(ua, req.Header.Get("User-Agent"))
+		fmt.Fprint(w, fakeSite(server.URL))
+	})
+	mux.HandleFunc("/10/playlist.m3u8", func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal("_session_id=SESSION", req.Header.Get("Cookie"))
+		fmt.Fprint(w, "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1\nchunklist.m3u8\n")
+	})
+	mux.HandleFunc("/10/chunklist.m3u8", func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, "#EXTM3U\n#EXTINF:10,\nmedia_0.ts\n#EXTINF:10,\nmedia_1.ts\n#EXT-X-ENDLIST\n")
+	})
+	mux.HandleFunc("/10/", func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, req.URL.Path)
+	})
+	playlists := 0
+	mux.HandleFunc("/13/playlist.m3u8", func(w http.ResponseWriter, req *http.Request) {
+		playlists++
+		fmt.Fprint(w, "#EXTM3U\n#EXTINF:10,\nmedia_0.aac\n#EXTINF:10,\nmedia_1.aac\n#EXT-X-ENDLIST\n")
+	})
+	mux.HandleFunc("/13/", func(w http.ResponseWriter, req *http.Request) {
+		// Packed audio: an ID3 tag followed by ADTS frames of AAC-LC, 48kHz, stereo
+		w.Write([]byte("ID3\x04\x00\x00\x00\x00\x00\x00"))
+		for i := 0; i < 2; i++ {
+			w.Write([]byte{0xff, 0xf1, 0x4c, 0x80, 0x01, 0x1f, 0xfc, byte(i)})
+		}
+	})
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal(filepath.Join(dir, "test-10.ts")+"\n", out.String())
+		assert.Equal("test/12: empty manifest, may be inaccessible\n", err.String())
+
+		f, _ := os.ReadFile(filepath.Join(dir, "test-10.ts"))
+		assert.Equal("/10/media_0.ts/10/media_1.ts", string(f))
+	}, "get", "test/10", "test/12", "--raw", "-d", dir, "-s", "SESSION", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.EqualError(Execute(), "get: 1 episode(s) failed")
+		assert.Equal(filepath.Join(dir, "test-10.ts")+"\n"+filepath.Join(dir, "test-13.aac")+"\n", out.String())
+		assert.Equal(
+			// Expiring first
+			"test/11: "+server.URL+"/11/playlist.m3u8: 404 Not Found\n"+
+				"test/10: "+filepath.Join(dir, "test-10.ts")+" exists, skipped\n"+
+				"Error: get: 1 episode(s) failed\n",
+			err.String(),
+		)
+
+		_, e := os.Stat(filepath.Join(dir, "test-11.ts"))
+		assert.True(os.IsNotExist(e))
+	}, "get", "test", "--raw", "-d", dir, "-s", "SESSION", "--retries", "0", "--backend", server.URL)
+
+	// The session is not sent to other hosts
+	{
+		var (
+			cookies []string
+			cdnDir  = t.TempDir()
+		)
+		cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			cookies = append(cookies, req.Header.Get("Cookie"))
+			switch req.URL.Path {
+			case "/10/playlist.m3u8":
+				fmt.Fprint(w, "#EXTM3U\n#EXTINF:10,\nmedia_0.ts\n#EXT-X-ENDLIST\n")
+			default:
+				fmt.Fprint(w, req.URL.Path)
+			}
+		}))
+		defer cdn.Close()
+		mux.HandleFunc("/cdn", func(w http.ResponseWriter, req *http.Request) {
+			assert.Equal("_session_id=SESSION", req.Header.Get("Cookie"))
+			fmt.Fprint(w, fakeSite(cdn.URL))
+		})
+
+		execute(func(out b, err b) {
+			assert.NoError(Execute())
+			assert.Equal(filepath.Join(cdnDir, "test-10.ts")+"\n", out.String())
+			assert.Equal([]string{"", ""}, cookies)
+		}, "get", "test/10", "--raw", "-d", cdnDir, "-s", "SESSION", "--backend", server.URL+"/cdn")
+	}
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal(filepath.Join(dir, "test-13.m4a")+"\n", out.String())
+
+		// Remuxed from the stream left by the previous run
+		f, _ := os.ReadFile(filepath.Join(dir, "test-13.m4a"))
+		assert.Equal("ftypM4A ", string(f[4:12]))
+		assert.Contains(string(f), "テスト")
+		assert.Contains(string(f), "特別編")
+
+		_, e := os.Stat(filepath.Join(dir, "test-13.aac"))
+		assert.True(os.IsNotExist(e))
+	}, "get", "test/13", "--raw=false", "-d", dir, "--backend", server.URL)
+
+	// A remuxed file is skipped without requesting the playlist
+	execute(func(out b, err b) {
+		n := playlists
+		assert.NoError(Execute())
+		assert.Equal(filepath.Join(dir, "test-13.m4a")+"\n", out.String())
+		assert.Equal("test/13: "+filepath.Join(dir, "test-13.m4a")+" exists, skipped\n", err.String())
+		assert.Equal(n, playlists)
+	}, "get", "test/13", "--raw=false", "-d", dir, "--backend", server.URL)
+
+	lib := filepath.Join(dir, "archive")
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal(filepath.Join(lib, "test-13.m4a")+"\n", out.String())
+
+		f, _ := os.ReadFile(filepath.Join(lib, "index.json"))
+		assert.Contains(string(f), `"path": "test-13.m4a"`)
+		assert.Contains(string(f), `"radio": "test"`)
+	}, "get", "test/13", "--archive", lib, "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal(filepath.Join(lib, "test-13.m4a")+"\n", out.String())
+		assert.Equal("test/13: archived as "+filepath.Join(lib, "test-13.m4a")+", skipped\n", err.String())
+	}, "get", "test/13", "--archive", lib, "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal(
+			"d---*---! 4 Nov  7 2025 test    テスト\n"+
+				"-r-s----- 1 Nov  7 2025 test/10 第2回 # 日高里菜\n"+
+				"-r-s----! 1 Oct 31 2025 test/11 第1回\n"+
+				"---s-+$-- 1 Oct 31 2025 test/12 第1回 おまけ\n"+
+				"-r-s---a- 1 Oct 24 2025 test/13 特別編\n",
+			out.String(),
+		)
+	}, "ls", "test", "--archive", lib, "--backend", server.URL)
+
+	lsm.filter = filterFlags{}
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("-r-s---a- 13\n", out.String())
+	}, "lsm", "test/13", "--format", "{{letters .}} {{.Id}}", "--archive", lib, "--backend", server.URL)
+	root.format = ""
+
+	// Tampered, downloaded again
+	os.WriteFile(filepath.Join(lib, "test-13.m4a"), []byte("broken"), 0644)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal(filepath.Join(lib, "test-13.m4a")+"\n", out.String())
+		assert.Equal("test/13: Verify: test-13.m4a: mismatched size or checksum, downloading again\n", err.String())
+
+		f, _ := os.ReadFile(filepath.Join(lib, "test-13.m4a"))
+		assert.Equal("ftypM4A ", string(f[4:12]))
+	}, "get", "test/13", "--archive", lib, "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.EqualError(Execute(), "sync: --archive is required")
+	}, "sync", "--archive=", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("test/11\ntest/10\n", out.String())
+		assert.Equal("2: not found\n", err.String())
+	}, "sync", "--dry-run", "--archive", lib, "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.EqualError(Execute(), "sync: 1 episode(s) failed")
+		assert.Equal(filepath.Join(lib, "test-10.ts")+"\n", out.String())
+		assert.Equal(
+			"2: not found\n"+
+				"test/11: "+server.URL+"/11/playlist.m3u8: 404 Not Found\n"+
+				"Error: sync: 1 episode(s) failed\n",
+			err.String(),
+		)
+	}, "sync", "--dry-run=false", "--raw", "--retries", "0", "--archive", lib, "-s", "SESSION", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("test/11\n", out.String())
+		assert.Equal("", err.String())
+	}, "sync", "-n", "--radios", "test,test", "--archive", lib, "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("", out.String())
+	}, "sync", "-n", "--where", "not expiring", "--radios", "test", "--archive", lib, "--backend", server.URL)
+	syncer.filter = filterFlags{}
+}
+
+func TestFeed(t *testing.T) {
+	type b = *strings.Builder
+
+	var (
+		assert = assert.New(t)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			fmt.Fprint(w, fakeSite("http://cdn"))
+		}))
+		dir = t.TempDir()
+
+		execute = func(fn func(b, b), input ...string) {
+			out := root.out.(b)
+			err := root.err.(b)
+
+			root.oo, root.lib = nil, nil
+			root.cmd.SetArgs(input)
+			fn(out, err)
+
+			out.Reset()
+			err.Reset()
+		}
+	)
+	defer server.Close()
+	defer func() { root.oo, root.lib, root.archive = nil, nil, "" }()
+
+	lib, _ := archive.Open(dir)
+	os.WriteFile(filepath.Join(dir, "test 13.m4a"), []byte("hello"), 0644)
+	lib.Add(archive.Entry{Id: 13, RadioId: 1, Path: filepath.Join(dir, "test 13.m4a")})
+
+	execute(func(out b, err b) {
+		assert.EqualError(Execute(), "nosuchradio: not found")
+	}, "feed", "nosuchradio", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Contains(out.String(), "<title>テスト</title>")
+		assert.Contains(out.String(), "<itunes:author>藤田茜</itunes:author>")
+		assert.Equal(3, strings.Count(out.String(), "<item>"))
+		assert.Contains(out.String(), "<description>第2回 (Guests: 日高里菜)</description>")
+		assert.Contains(out.String(), `<enclosure url="http://cdn/10/playlist.m3u8" length="0" type="application/x-mpegURL">`)
+	}, "feed", "test", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.EqualError(Execute(), "feed: --base-url requires --archive")
+	}, "feed", "test", "--base-url", "http://nas/radio", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal(1, strings.Count(out.String(), "<item>"))
+		assert.Contains(out.String(), `<enclosure url="http://nas/radio/test%2013.m4a" length="5" type="audio/mp4">`)
+	}, "feed", "test", "--base-url", "http://nas/radio", "--archive", dir, "--backend", server.URL)
+}
+
+func TestMe(t *testing.T) {
+	type b = *strings.Builder
+
+	var (
+		assert = assert.New(t)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			site := fakeSite("http://cdn")
+			if req.URL.Path == "/anonymous" {
+				site = strings.Replace(site, `"sign_in":`, `"sign_in":null,"_":`, 1)
+			}
+			fmt.Fprint(w, site)
+		}))
+
+		execute = func(fn func(b, b), input ...string) {
+			out := root.out.(b)
+			err := root.err.(b)
+
+			root.oo = nil
+			root.cmd.SetArgs(input)
+			fn(out, err)
+
+			out.Reset()
+			err.Reset()
+		}
+	)
+	defer server.Close()
+	defer func() { root.oo, root.output, root.format, root.session = nil, outputTable, "", "" }()
+
+	execute(func(out b, err b) {
+		assert.EqualError(Execute(), "me: no user signed in")
+	}, "me", "--unheard=false", "--backend", server.URL+"/anonymous")
+
+	// A session is given, but the page is of anonymous users
+	execute(func(out b, err b) {
+		e := Execute()
+		assert.Equal(onsen.ErrSessionExpired, e)
+		assert.Equal(ExitSessionExpired, ExitCode(e))
+		assert.Equal(ExitFailure, ExitCode(errors.New("me: no user signed in")))
+		assert.Equal(0, ExitCode(nil))
+	}, "me", "--unheard=false", "-s", "EXPIRED", "--backend", server.URL+"/anonymous")
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal(
+			"email:     test@example.com\n"+
+				"uid:       test\n"+
+				"premium:   ios, until 2025-11-15\n"+
+				"social:    apple\n"+
+				"following: 2 radio(s), 1 people\n"+
+				"playlist:  0 episode(s)\n"+
+				"history:   2 episode(s), 1 watched\n",
+			out.String(),
+		)
+	}, "me", "--unheard=false", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+
+		var u userModel
+		assert.NoError(json.Unmarshal([]byte(out.String()), &u))
+		assert.Equal("ios", u.Premium)
+		assert.Equal([]listenedModel{{10, "test", true, 0}, {13, "test", false, 3723}}, u.History)
+	}, "me", "--unheard=false", "-o", "json", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.EqualError(Execute(), "me: --output csv is not supported, use json or ndjson")
+	}, "me", "--unheard=false", "-o", "csv", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal(
+			"-r-s----- 1:02:03 Oct 24 2025 test/13 特別編\n"+
+				"-r-s----!       - Oct 31 2025 test/11 第1回\n"+
+				"---s-+$--       - Oct 31 2025 test/12 第1回 おまけ\n",
+			out.String(),
+		)
+	}, "me", "--unheard", "-o", "table", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("test/13\ntest/11\ntest/12\n", out.String())
+	}, "me", "--unheard", "--format", "{{.Radio.Name}}/{{.Id}}", "--backend", server.URL)
+}
+
+func TestPeople(t *testing.T) {
+	type b = *strings.Builder
+
+	var (
+		assert = assert.New(t)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			fmt.Fprint(w, fakeSite("http://cdn"))
+		}))
+
+		execute = func(fn func(b, b), input ...string) {
+			out := root.out.(b)
+			err := root.err.(b)
+
+			root.oo = nil
+			root.cmd.SetArgs(input)
+			fn(out, err)
+
+			out.Reset()
+			err.Reset()
+		}
+	)
+	defer server.Close()
+	defer func() { root.oo, root.output, root.format = nil, outputTable, "" }()
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal(
+			"d-------- 1 Nov  7 2025 藤田茜          1 radio(s), 0 guest appearance(s)\n"+
+				"d-------- 1 Nov  7 2025 日高里菜         0 radio(s), 1 guest appearance(s)\n",
+			out.String(),
+		)
+	}, "people", "-o", "table", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal(
+			"d-------- 1 Nov  7 2025 日高里菜         0 radio(s), 1 guest appearance(s)\n"+
+				"-r-s----- 1 Nov  7 2025 test/10      第2回 # 日高里菜\n"+
+				"d-------- 1 Nov  7 2025 藤田茜          1 radio(s), 0 guest appearance(s)\n"+
+				"d---*---! 4 Nov  7 2025 test         テスト\n",
+			out.String(),
+		)
+		assert.Equal("nobody: not found\n", err.String())
+	}, "people", "200", "藤田茜", "nobody", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+
+		var ps []personDetailModel
+		assert.NoError(json.Unmarshal([]byte(out.String()), &ps))
+		assert.Len(ps, 1)
+		assert.Equal("藤田茜", ps[0].Name)
+		assert.Equal("test", ps[0].Radios[0].Name)
+		assert.Empty(ps[0].Episodes)
+	}, "people", "100", "-o", "json", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("id,name,radios,episodes\n100,藤田茜,test,\n200,日高里菜,,test/10\n", out.String())
+	}, "people", "100", "200", "-o", "csv", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal(
+			"d-------- 藤田茜 2025-11-07 test\n"+
+				"d-------- 日高里菜 2025-11-07 test/10 第2回\n",
+			out.String(),
+		)
+	}, "people", "100", "200", "--backend", server.URL, "--format",
+		`{{letters .}} {{.Name}} {{.Date}}{{range .Hosted}} {{.Name}}{{end}}{{range .Guested}} {{.Radio.Name}}/{{.Id}} {{.Title}}{{end}}`)
+}
+
+func TestFeaturing(t *testing.T) {
+	type b = *strings.Builder
+
+	var (
+		assert = assert.New(t)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			site := fakeSite("http://cdn")
+			if req.URL.Path == "/anonymous" {
+				site = strings.Replace(site, `"sign_in":`, `"sign_in":null,"_":`, 1)
+			}
+			fmt.Fprint(w, site)
+		}))
+
+		execute = func(fn func(b, b), input ...string) {
+			out := root.out.(b)
+			err := root.err.(b)
+
+			root.oo = nil
+			// Flags stay set between executions
+			featuring.filter = filterFlags{}
+			root.cmd.SetArgs(input)
+			fn(out, err)
+
+			out.Reset()
+			err.Reset()
+		}
+	)
+	defer server.Close()
+	defer func() { root.oo, root.output, root.format = nil, outputTable, "" }()
+
+	execute(func(out b, err b) {
+		assert.EqualError(Execute(), "featuring: no user signed in, set a session or provide names")
+	}, "featuring", "--backend", server.URL+"/anonymous")
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal(
+			"-r-s----- 1 Oct 24 2025 test/13 特別編\n"+
+				"-r-s----! 1 Oct 31 2025 test/11 第1回\n"+
+				"---s-+$-- 1 Oct 31 2025 test/12 第1回 おまけ\n"+
+				"-r-s----- 1 Nov  7 2025 test/10 第2回 # 日高里菜\n",
+			out.String(),
+		)
+	}, "featuring", "-o", "table", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("test/11\ntest/12\ntest/10\n", out.String())
+	}, "featuring", "--after", "2025-10-31", "--format", "{{.Radio.Name}}/{{.Id}}", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("test/10\n", out.String())
+		assert.Equal("nobody: not found\n", err.String())
+	}, "featuring", "日高里菜", "nobody", "--format", "{{.Radio.Name}}/{{.Id}}", "--backend", server.URL)
+}
+
+func TestSearch(t *testing.T) {
+	type b = *strings.Builder
+
+	var (
+		assert = assert.New(t)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			fmt.Fprint(w, fakeSite("http://cdn"))
+		}))
+
+		execute = func(fn func(b, b), input ...string) {
+			out := root.out.(b)
+			err := root.err.(b)
+
+			root.oo = nil
+			// Flags stay set between executions
+			search.limit = 20
+			root.cmd.SetArgs(input)
+			fn(out, err)
+
+			out.Reset()
+			err.Reset()
+		}
+	)
+	defer server.Close()
+	defer func() { root.oo, root.output, root.format = nil, outputTable, "" }()
+
+	execute(func(out b, err b) {
+		assert.Error(Execute())
+	}, "search", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("d---*---! 4 Nov  7 2025 test テスト\n", out.String())
+	}, "search", "てすと", "-o", "table", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal(
+			"d-------- 1 Nov  7 2025 日高里菜         0 radio(s), 1 guest appearance(s)\n"+
+				"-r-s----- 1 Nov  7 2025 test/10      第2回 # 日高里菜\n",
+			out.String(),
+		)
+	}, "search", "日高", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+
+		var ms []searchModel
+		assert.NoError(json.Unmarshal([]byte(out.String()), &ms))
+		assert.Len(ms, 1)
+		assert.Equal("person", ms[0].Kind)
+		assert.Equal(200, ms[0].Person.Id)
+	}, "search", "日高", "-n", "1", "-o", "json", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		lines := strings.Split(out.String(), "\n")
+		assert.Equal("kind\tscore\tid\tname\ttitle", lines[0])
+		assert.Equal("person\t", lines[1][:7])
+		assert.Equal("episode\t", lines[2][:8])
+		assert.True(strings.HasSuffix(lines[2], "\t10\ttest\t第2回"))
+	}, "search", "日高", "-o", "tsv", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("person 日高里菜 test/10\nepisode -r-s----- test/10 第2回\n", out.String())
+	}, "search", "日高", "--backend", server.URL, "--format",
+		`{{.Kind}} {{with .Person}}{{.Name}}{{range .Guested}} {{.Radio.Name}}/{{.Id}}{{end}}{{end}}`+
+			`{{with .Episode}}{{letters .}} {{.Radio.Name}}/{{.Id}} {{.Title}}{{end}}`)
+}
+
+func TestSnapshot(t *testing.T) {
+	type b = *strings.Builder
+
+	var (
+		assert = assert.New(t)
+		store  = filepath.Join(t.TempDir(), "snapshots")
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			site := fakeSite("http://cdn")
+			if req.URL.Path == "/changed" {
+				site = strings.Replace(site, `"title":"テスト"`, `"title":"テスト2"`, 1)
+				site = strings.Replace(site, `"id":13,"title":"特別編"`, `"id":14,"title":"特別編"`, 1)
+			}
+			if req.URL.Path == "/anonymous" {
+				site = strings.Replace(site, `"sign_in":`, `"sign_in":null,"_":`, 1)
+			}
+			fmt.Fprint(w, site)
+		}))
+
+		execute = func(fn func(b, b), input ...string) {
+			out := root.out.(b)
+			err := root.err.(b)
+
+			root.oo, root.session = nil, ""
+			snap.list = false
+			root.cmd.SetArgs(input)
+			fn(out, err)
+
+			out.Reset()
+			err.Reset()
+		}
+	)
+	defer server.Close()
+	defer func() { root.oo, root.output, root.format, root.session, snap.store = nil, outputTable, "", "", "" }()
+
+	execute(func(out b, err b) {
+		assert.EqualError(Execute(), "diff: no snapshot in "+store+", take one by the snapshot command")
+	}, "diff", "--store", store, "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.Equal(onsen.ErrSessionExpired, Execute())
+		ss, _ := os.ReadDir(store)
+		assert.Empty(ss)
+	}, "snapshot", "--store", store, "-s", "EXPIRED", "--backend", server.URL+"/anonymous")
+
+	var name string
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		path := strings.TrimSpace(out.String())
+		assert.Equal(store, filepath.Dir(path))
+		assert.FileExists(path)
+		name = strings.TrimSuffix(filepath.Base(path), ".json")
+	}, "snapshot", "--store", store, "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal(name+"\n", out.String())
+	}, "snapshot", "--list", "--store", store)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("", out.String())
+	}, "diff", "--store", store, "--backend", server.URL)
+
+	const want = "~ test テスト -> テスト2\n" +
+		"+ test/14 特別編\n" +
+		"- test/13 特別編\n"
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal(want, out.String())
+	}, "diff", "--store", store, "--backend", server.URL+"/changed")
+
+	// A dump of the changed site as a file
+	changed := filepath.Join(t.TempDir(), "changed.json")
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.NoError(os.WriteFile(changed, []byte(out.String()), 0644))
+	}, "dump", "--backend", server.URL+"/changed")
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal(want, out.String())
+	}, "diff", name, changed, "--store", store)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal(
+			"kind,radio_id,radio,episode_id,title,old,new\n"+
+				"title_changed,1,test,,テスト2,テスト,テスト2\n"+
+				"episode_added,1,test,14,特別編,,\n"+
+				"episode_removed,1,test,13,特別編,,\n",
+			out.String(),
+		)
+	}, "diff", name, changed, "-o", "csv", "--store", store)
+
+	execute(func(out b, err b) {
+		assert.EqualError(Execute(), "diff: nothing: neither a snapshot in "+store+" nor a file")
+	}, "diff", "nothing", "-o", "table", "--store", store)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal(
+			"title_changed test テスト2 (テスト -> テスト2)\n"+
+				"episode_added test/14 特別編 -r-s----- [+ test/14 特別編]\n"+
+				"episode_removed test/13 特別編 -r-s----- [- test/13 特別編]\n",
+			out.String(),
+		)
+	}, "diff", name, changed, "--store", store, "--format",
+		`{{.Kind}} {{.Radio.Name}}{{with .Episode}}/{{.Id}} {{.Title}} {{letters .}} [{{$.Line}}]{{else}} {{.Radio.Title}} ({{.Old}} -> {{.New}}){{end}}`)
+}
+
+func TestWatch(t *testing.T) {
+	type b = *strings.Builder
+
+	var (
+		assert   = assert.New(t)
+		requests = 0
+		server   = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			site := fakeSite("http://cdn")
+			// The first request of a watch is the baseline
+			if requests%2 == 1 {
+				site = strings.Replace(site, `"id":13,"title":"特別編"`, `"id":14,"title":"特別編"`, 1)
+				site = strings.Replace(site, `"streaming_url":null`, `"streaming_url":"http://cdn/12/playlist.m3u8"`, 1)
+				if req.URL.Path == "/expiring" {
+					site = strings.Replace(site, `"sign_in":`, `"sign_in":null,"_":`, 1)
+				}
+			}
+			requests++
+			fmt.Fprint(w, site)
+		}))
+
+		execute = func(fn func(b, b), input ...string) {
+			out := root.out.(b)
+			err := root.err.(b)
+
+			root.oo = nil
+			watch.exec = ""
+			root.cmd.SetArgs(input)
+			fn(out, err)
+
+			out.Reset()
+			err.Reset()
+		}
+	)
+	defer server.Close()
+	defer func() { root.oo, root.output, root.format, root.session = nil, outputTable, "", "" }()
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("* test/12 第1回 おまけ (accessible)\n+ test/14 特別編\n", out.String())
+	}, "watch", "--interval", "1ms", "--count", "1", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+
+		var ms []eventModel
+		dec := json.NewDecoder(strings.NewReader(out.String()))
+		for dec.More() {
+			var m eventModel
+			assert.NoError(dec.Decode(&m))
+			ms = append(ms, m)
+		}
+		assert.Len(ms, 2)
+		assert.Equal(onsen.EpisodeAccessible, ms[0].Kind)
+		assert.Equal(12, ms[0].EpisodeId)
+		assert.Equal("http://cdn/12/playlist.m3u8", ms[0].Manifest)
+		assert.Equal(onsen.EpisodeAdded, ms[1].Kind)
+		assert.Equal("test", ms[1].Radio)
+		assert.Equal(14, ms[1].EpisodeId)
+		assert.False(ms[1].Time.IsZero())
+	}, "watch", "--interval", "1ms", "--count", "1", "-o", "ndjson", "--backend", server.URL)
+
+	log := filepath.Join(t.TempDir(), "events")
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		b, _ := os.ReadFile(log)
+		assert.Equal(
+			"episode_accessible test/12 第1回 おまけ http://cdn/12/playlist.m3u8 episode_accessible\n"+
+				"episode_added test/14 特別編 http://cdn/13/playlist.m3u8 episode_added\n",
+			string(b),
+		)
+	}, "watch", "--interval", "1ms", "--count", "1", "--backend", server.URL, "-o", "table", "--exec",
+		`echo "$ONSENGO_KIND $ONSENGO_RADIO/$ONSENGO_EPISODE_ID $ONSENGO_TITLE $ONSENGO_MANIFEST $(sed 's/.*"kind":"\([a-z_]*\)".*/\1/')" >> `+log)
+
+	// The template overrides the line, --exec still has the JSON
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal(
+			"episode_accessible test/12 true http://cdn/12/playlist.m3u8\n"+
+				"episode_added test/14 true http://cdn/13/playlist.m3u8\n",
+			out.String(),
+		)
+		assert.Equal("episode_accessible\nepisode_added\n", err.String())
+	}, "watch", "--interval", "1ms", "--count", "1", "--backend", server.URL, "--format",
+		`{{.Kind}} {{with .Episode}}{{.Radio.Name}}/{{.Id}}{{end}} {{not .Time.IsZero}} {{.Episode.Manifest}}`,
+		"--exec", `sed 's/.*"kind":"\([a-z_]*\)".*/\1/' >&2`)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Contains(err.String(), "exec: + test/14 特別編: exit status 1")
+	}, "watch", "--interval", "1ms", "--count", "1", "--backend", server.URL, "--exec", "exit 1")
+
+	// Stops as the session expires
+	execute(func(out b, err b) {
+		assert.Equal(onsen.ErrSessionExpired, Execute())
+		assert.NotContains(out.String(), "test/14")
+	}, "watch", "--interval", "1ms", "--count", "3", "-s", "SESSION", "--backend", server.URL+"/expiring")
+
+	execute(func(out b, err b) {
+		assert.EqualError(Execute(), "watch: --output json is not supported, use ndjson")
+	}, "watch", "-o", "json", "--backend", server.URL)
+}
+
+func TestNotify(t *testing.T) {
+	type b = *strings.Builder
+
+	var (
+		assert = assert.New(t)
+		dir    = t.TempDir()
+		store  = filepath.Join(dir, "snapshots")
+		rules  = filepath.Join(dir, "rules.json")
+		hooks  = make(chan map[string]interface{}, 10)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodPost {
+				var v map[string]interface{}
+				json.NewDecoder(req.Body).Decode(&v)
+				hooks <- v
+				return
+			}
+			site := fakeSite("http://cdn")
+			if req.URL.Path == "/changed" {
+				site = strings.Replace(site, `"id":13,"title":"特別編"`, `"id":14,"title":"特別編"`, 1)
+				site = strings.Replace(site, `"id":10,"title":"第2回"`, `"id":15,"title":"第2回"`, 1)
+			}
+			if req.URL.Path == "/anonymous" {
+				site = strings.Replace(site, `"sign_in":`, `"sign_in":null,"_":`, 1)
+			}
+			fmt.Fprint(w, site)
+		}))
+
+		execute = func(fn func(b, b), input ...string) {
+			out := root.out.(b)
+			err := root.err.(b)
+
+			root.oo = nil
+			notif.dryRun = false
+			root.cmd.SetArgs(input)
+			fn(out, err)
+
+			out.Reset()
+			err.Reset()
+		}
+	)
+	defer server.Close()
+	defer func() { root.oo, root.session, snap.store = nil, "", "" }()
+
+	os.WriteFile(rules, []byte(`{
+		"notifiers": {
+			"hook": {"type": "webhook", "url": "`+server.URL+`/hook"},
+			"slack": {"type": "slack", "url": "`+server.URL+`/slack"}
+		},
+		"rules": [
+			{"radios": ["test"], "notify": ["hook"], "subject": "{{.Radio.Name}}/{{.Episode.Id}}"},
+			{"people": ["日高里菜"], "notify": ["slack"]}
+		]
+	}`), 0644)
+
+	execute(func(out b, err b) {
+		assert.EqualError(Execute(), "notify: no snapshot in "+store+" to compare to")
+	}, "notify", "--rules", rules, "--store", store, "-n", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Empty(out.String())
+		assert.Contains(err.String(), "notify: no snapshot to compare to, saved "+store)
+	}, "notify", "--rules", rules, "--store", store, "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal(
+			"test/15 -> hook: test/15\n"+
+				"test/15 -> slack: テスト 第2回\n"+
+				"test/14 -> hook: test/14\n",
+			out.String(),
+		)
+		assert.Empty(hooks)
+	}, "notify", "--rules", rules, "--store", store, "-n", "--backend", server.URL+"/changed")
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("test/15 -> hook\ntest/15 -> slack\ntest/14 -> hook\n", out.String())
+
+		v := <-hooks
+		assert.Equal("test/15", v["subject"])
+		assert.Equal([]interface{}{"日高里菜"}, v["guests"])
+		v = <-hooks
+		assert.Equal("テスト 第2回\nテスト\n第2回\nゲスト: 日高里菜\nhttps://www.onsen.ag/program/test\n", v["text"])
+		v = <-hooks
+		assert.Equal("test/14", v["subject"])
+	}, "notify", "--rules", rules, "--store", store, "--backend", server.URL+"/changed")
+
+	// Nothing new since the last run
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Empty(out.String())
+	}, "notify", "--rules", rules, "--store", store, "--backend", server.URL+"/changed")
+
+	// An expired session saves no snapshot of the anonymous page
+	execute(func(out b, err b) {
+		ss, _ := os.ReadDir(store)
+		assert.Equal(onsen.ErrSessionExpired, Execute())
+		assert.NotContains(out.String(), "test/")
+		after, _ := os.ReadDir(store)
+		assert.Len(after, len(ss))
+	}, "notify", "--rules", rules, "--store", store, "-s", "EXPIRED", "--backend", server.URL+"/anonymous")
+	root.session = ""
+
+	execute(func(out b, err b) {
+		assert.Error(Execute())
+	}, "notify", "--rules", filepath.Join(dir, "nothing.json"), "--store", store, "--backend", server.URL)
+}
+
+func TestServe(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		index  = filepath.Join(t.TempDir(), "index.html")
+
+		request = func(url string, v interface{}) int {
+			resp, err := http.Get(url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			assert.Equal("application/json; charset=utf-8", resp.Header.Get("Content-Type"))
+			json.NewDecoder(resp.Body).Decode(v)
+			return resp.StatusCode
+		}
+	)
+	defer func(backend string) { root.backend = backend }(root.backend)
+
+	os.WriteFile(index, []byte(fakeSite("http://cdn")), 0644)
+	root.backend = "file://" + index
+
+	a, err := newAPI(root.fetch)
+	assert.NoError(err)
+	server := httptest.NewServer(a)
+	defer server.Close()
+
+	{
+		var out []radioModel
+		assert.Equal(200, request(server.URL+"/radios", &out))
+		assert.Len(out, 1)
+		assert.Equal("test", out[0].Name)
+		assert.Equal(4, out[0].Count)
+		assert.Nil(out[0].Episodes)
+		assert.Equal("2025-11-07T00:00:00+09:00", out[0].UpdatedAt.Format(time.RFC3339))
+	}
+	for _, name := range []string{"test", "1"} {
+		var out radioModel
+		assert.Equal(200, request(server.URL+"/radios/"+name, &out))
+		assert.Equal("テスト", out.Title)
+		assert.Equal([]personModel{{100, "藤田茜"}}, out.Hosts)
+		assert.Len(out.Episodes, 4)
+		assert.Equal("", out.Episodes[2].Manifest)
+		assert.True(out.Episodes[2].Premium)
+	}
+	{
+		var out map[string]string
+		assert.Equal(404, request(server.URL+"/radios/nosuchradio", &out))
+		assert.Equal("nosuchradio: not found", out["error"])
+		assert.Equal(400, request(server.URL+"/episodes/x", &out))
+		assert.Equal("invalid id", out["error"])
+		assert.Equal(404, request(server.URL+"/people/999", &out))
+	}
+	{
+		var out episodeModel
+		assert.Equal(200, request(server.URL+"/episodes/10", &out))
+		assert.Equal("第2回", out.Title)
+		assert.Equal(1, out.RadioId)
+		assert.Equal("http://cdn/10/playlist.m3u8", out.Manifest)
+		assert.Equal([]personModel{{200, "日高里菜"}}, out.Guests)
+	}
+	{
+		var out struct {
+			Name     string
+			Radios   []radioModel
+			Episodes []episodeModel
+		}
+		assert.Equal(200, request(server.URL+"/people/100", &out))
+		assert.Equal("藤田茜", out.Name)
+		assert.Len(out.Radios, 1)
+		assert.Empty(out.Episodes)
+
+		assert.Equal(200, request(server.URL+"/people/200", &out))
+		assert.Equal("日高里菜", out.Name)
+		assert.Len(out.Episodes, 1)
+	}
+	{
+		var out userModel
+		assert.Equal(200, request(server.URL+"/me", &out))
+		assert.Equal("test@example.com", out.Email)
+		assert.Equal([]int{1, 2}, out.FollowingRadios)
+	}
+	{
+		// Refreshed
+		os.WriteFile(index, []byte(strings.Replace(fakeSite("http://cdn"), "テスト", "テスト2", 1)), 0644)
+		assert.NoError(a.refresh())
+
+		var out radioModel
+		request(server.URL+"/radios/test", &out)
+		assert.Equal("テスト2", out.Title)
+
+		// The old one is kept on failure
+		os.WriteFile(index, []byte("<html></html>"), 0644)
+		assert.Error(a.refresh())
+		request(server.URL+"/radios/test", &out)
+		assert.Equal("テスト2", out.Title)
+	}
+}
+
+func TestOutput(t *testing.T) {
+	type b = *strings.Builder
+
+	var (
+		assert = assert.New(t)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			fmt.Fprint(w, fakeSite("http://cdn"))
+		}))
+
+		execute = func(fn func(b, b), input ...string) {
+			out := root.out.(b)
+			err := root.err.(b)
+
+			root.oo = nil
+			// Flags stay set between executions
+			ls.recursive, ls.filter, lsm.filter = false, filterFlags{}, filterFlags{}
+			root.cmd.SetArgs(input)
+			fn(out, err)
+
+			out.Reset()
+			err.Reset()
+		}
+	)
+	defer server.Close()
+	defer func() { root.oo, root.output, root.format = nil, outputTable, "" }()
+
+	execute(func(out b, err b) {
+		assert.Error(Execute())
+		assert.Contains(err.String(), `invalid argument "xml" for "-o, --output" flag: unknown format "xml"`)
+	}, "ls", "-o", "xml", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+
+		var rs []radioModel
+		assert.NoError(json.Unmarshal([]byte(out.String()), &rs))
+		assert.Len(rs, 1)
+		assert.Equal("test", rs[0].Name)
+		assert.Equal(4, rs[0].Count)
+		assert.Nil(rs[0].Episodes)
+	}, "ls", "-o", "json", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal(
+			"id,name,title,hosts,updated_at,new,episode_count\n"+
+				"1,test,テスト,藤田茜,2025-11-07T00:00:00+09:00,true,4\n",
+			out.String(),
+		)
+	}, "ls", "-o", "csv", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+
+		lines := strings.Split(out.String(), "\n")
+		assert.Len(lines, 6)
+		assert.Equal(
+			"radio_id\tradio\tid\ttitle\tupdated_at\tguests\tmanifest\tbonus\tsticky\tlatest\tpremium\tvideo\t"+
+				"media_type\texpiring\tongen_id",
+			lines[0],
+		)
+		assert.Equal(
+			"1\ttest\t10\t第2回\t2025-11-07T00:00:00+09:00\t日高里菜\thttp://cdn/10/playlist.m3u8\tfalse\tfalse\tfalse\tfalse\tfalse\t"+
+				"sound\tfalse\t1010",
+			lines[1],
+		)
+		assert.Equal("nosuchradio: not found\n", err.String())
+	}, "ls", "test", "nosuchradio", "-o", "tsv", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		assert.Len(lines, 3)
+
+		var e episodeModel
+		assert.NoError(json.Unmarshal([]byte(lines[2]), &e))
+		assert.Equal(13, e.Id)
+		assert.Equal("test", e.Radio)
+		assert.Equal("http://cdn/13/playlist.m3u8", e.Manifest)
+		// Documented fields are kept even if false
+		assert.Contains(lines[2], `"premium":false`)
+	}, "lsm", "-o", "ndjson", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("http://cdn/10/playlist.m3u8\n", out.String())
+	}, "lsm", "test/10", "-o", "table", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.EqualError(Execute(), `--format: template: format:1: function "nosuchfunc" not defined`)
+	}, "lsm", "--format", "{{nosuchfunc .}}", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal(
+			"test/10 2025-11-07 http://cdn/10/playlist.m3u8\n"+
+				"test/11 2025-10-31 http://cdn/11/playlist.m3u8\n"+
+				"test/13 2025-10-24 http://cdn/13/playlist.m3u8\n",
+			out.String(),
+		)
+	}, "lsm", "--format", "{{.Radio.Name}}/{{.Id}} {{.Date}} {{.Manifest}}", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("d---*---! test 4 Nov 7\n", out.String())
+	}, "ls", "--format", `{{letters .}} {{.Name}} {{len .Episodes}} {{jst "Jan 2" .Time}}`, "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal(
+			"-r-s----- 第2回 (日高里菜) テスト\n"+
+				"-r-s----! 第1回 () テスト\n"+
+				"---s-+$-- 第1回 おまけ () テスト\n"+
+				"-r-s----- 特別編 () テスト\n",
+			out.String(),
+		)
+	}, "ls", "test", "--format", `{{letters .}} {{.Title}} ({{join ", " .Guests}}) {{.Radio.Title}}`, "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("test/10\ntest/11\n", out.String())
+	}, "ls", "-r", "--where", "expiring or guest~日高", "--format", "{{.Radio.Name}}/{{.Id}}", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("", out.String())
+	}, "ls", "--where", "video", "--format=", "-o", "table", "--backend", server.URL)
+
+	// The count is of the episodes passing the filter
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("d---*---! 1 Nov  7 2025 test テスト\n", out.String())
+	}, "ls", "--where", "expiring", "--format=", "-o", "table", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal(
+			"id,name,title,hosts,updated_at,new,episode_count\n"+
+				"1,test,テスト,藤田茜,2025-11-07T00:00:00+09:00,true,1\n",
+			out.String(),
+		)
+		root.output = outputTable
+	}, "ls", "--where", "expiring", "-o", "csv", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("http://cdn/13/playlist.m3u8\n", out.String())
+	}, "lsm", "--where", "not guest~日高 and date<2025-10-31", "--format=", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.EqualError(Execute(), `--where: at 8: expected a value after "="`)
+	}, "lsm", "--where", "premium=", "--backend", server.URL)
+
+	// 2025-11-10 is a Monday, "test" is delivered on Fridays
+	for _, test := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"--since", "7d"}, "10"},
+		{[]string{"--since", "last-friday"}, "10"},
+		{[]string{"--since", "2025-10-31"}, "10 11"},
+		{[]string{"--before", "2025-10-31"}, "13"},
+		{[]string{"--on", "2025-10-31"}, "11"},
+		{[]string{"--after", "2025-10-24", "--before", "2025-11-07"}, "11 13"},
+		{[]string{"--weekday", "fri"}, "10 11 13"},
+		{[]string{"--weekday", "mon,金"}, "10 11 13"},
+		{[]string{"--weekday", "mon"}, ""},
+	} {
+		execute(func(out b, err b) {
+			assert.NoError(Execute())
+			assert.Equal(test.expected, strings.TrimSpace(strings.ReplaceAll(out.String(), "\n", " ")), test.args)
+		}, append([]string{"lsm", "--format", "{{.Id}}", "--backend", server.URL}, test.args...)...)
+	}
+
+	execute(func(out b, err b) {
+		assert.EqualError(Execute(), `--weekday: unknown weekday "someday"`)
+	}, "lsm", "--weekday", "someday", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.Error(Execute())
+		assert.Contains(err.String(), `invalid argument "4/1" for "--since" flag`)
+	}, "lsm", "--since", "4/1", "--backend", server.URL)
+}
+
+func TestConfig(t *testing.T) {
+	type b = *strings.Builder
+
+	var (
+		assert = assert.New(t)
+		dir    = t.TempDir()
+		path   = filepath.Join(dir, "onsengo", "config.json")
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			fmt.Fprint(w, fakeSite("http://cdn"))
+		}))
+
+		execute = func(fn func(b, b), input ...string) {
+			out := root.out.(b)
+			err := root.err.(b)
+
+			root.oo, root.conf = nil, nil
+			root.output, search.limit = outputTable, 20
+			// Flags stay changed between executions, which take precedence over the config
+			for _, c := range append(root.cmd.Commands(), root.cmd) {
+				c.Flags().VisitAll(func(f *pflag.Flag) { f.Changed = false })
+			}
+			root.cmd.SetArgs(input)
+			fn(out, err)
+
+			out.Reset()
+			err.Reset()
+		}
+	)
+	defer server.Close()
+	defer func() { root.oo, root.conf, root.output, root.session, search.limit = nil, nil, outputTable, "", 20 }()
+
+	t.Setenv("XDG_CONFIG_HOME", dir)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Empty(out.String())
+	}, "config", "list")
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		fi, _ := os.Stat(path)
+		assert.Equal(os.FileMode(0600), fi.Mode().Perm())
+	}, "config", "set", "output", "ndjson")
+
+	root.cmd.SetIn(strings.NewReader("SESSION\n"))
+	defer root.cmd.SetIn(nil)
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+	}, "config", "set", "session")
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+	}, "config", "set", "search.limit", "1")
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("output=ndjson\nsearch.limit=1\nsession=SESSION\n", out.String())
+	}, "config", "list")
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("ndjson\n", out.String())
+	}, "config", "get", "output")
+
+	execute(func(out b, err b) {
+		assert.EqualError(Execute(), `config: unknown key "nosuch", must be a global option or COMMAND.OPTION`)
+	}, "config", "set", "nosuch", "1")
+
+	execute(func(out b, err b) {
+		assert.EqualError(Execute(), `config: unknown key "config.list", must be a global option or COMMAND.OPTION`)
+	}, "config", "get", "config.list")
+
+	execute(func(out b, err b) {
+		assert.EqualError(Execute(), "config: format is not set")
+	}, "config", "get", "format")
+
+	// The config file
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("SESSION", root.session)
+		assert.Equal(1, strings.Count(out.String(), "\n"))
+		assert.True(strings.HasPrefix(out.String(), `{"kind":`))
+	}, "search", "回", "--backend", server.URL)
+
+	// The environment over the config file
+	t.Setenv("ONSENGO_OUTPUT", "json")
+	t.Setenv("ONSENGO_SEARCH_LIMIT", "0")
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		var ms []searchModel
+		assert.NoError(json.Unmarshal([]byte(out.String()), &ms))
+		assert.Len(ms, 3)
+	}, "search", "回", "--backend", server.URL)
+
+	// The command line over both
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("d---*---! 4 Nov  7 2025 test テスト\n", out.String())
+	}, "search", "テスト", "-o", "table", "-n", "1", "--backend", server.URL)
+
+	t.Setenv("ONSENGO_OUTPUT", "xml")
+	execute(func(out b, err b) {
+		assert.EqualError(Execute(), `config: output: unknown format "xml", must be one of json, ndjson, csv, tsv and table`)
+	}, "search", "テスト", "--backend", server.URL)
+	os.Unsetenv("ONSENGO_OUTPUT")
+
+	// Another file
+	other := filepath.Join(dir, "other.json")
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("SESSION\n", out.String())
+	}, "config", "get", "session", "--config", path)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+	}, "config", "set", "backend", server.URL, "--config", other)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("backend="+server.URL+"\n", out.String())
+	}, "config", "list", "--config", other)
+	root.configFile = ""
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+	}, "config", "unset", "session")
+
+	execute(func(out b, err b) {
+		assert.EqualError(Execute(), "config: session is not set")
+	}, "config", "unset", "session")
+}
+
+func TestLogin(t *testing.T) {
+	type b = *strings.Builder
+
+	var (
+		assert = assert.New(t)
+		dir    = t.TempDir()
+		path   = filepath.Join(dir, "onsengo", "session.json")
+		// Signed in only with the session "SESSION"
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			site := fakeSite("http://cdn")
+			if c, err := req.Cookie("_session_id"); err != nil || c.Value != "SESSION" {
+				site = strings.Replace(site, `"sign_in":`, `"sign_in":null,"_":`, 1)
+			}
+			fmt.Fprint(w, site)
+		}))
+
+		execute = func(fn func(b, b), stdin string, input ...string) {
+			out := root.out.(b)
+			err := root.err.(b)
+
+			root.oo, root.session, root.sessionRead, root.in = nil, "", false, nil
+			login.encrypt = false
+			root.cmd.SetIn(strings.NewReader(stdin))
+			root.cmd.SetArgs(input)
+			fn(out, err)
+
+			out.Reset()
+			err.Reset()
+		}
+	)
+	defer server.Close()
+	defer func() { root.oo, root.session, root.sessionRead, root.in = nil, "", false, nil }()
+	defer root.cmd.SetIn(nil)
+
+	t.Setenv("XDG_CONFIG_HOME", dir)
+
+	execute(func(out b, err b) {
+		assert.EqualError(Execute(), "whoami: no session, see the login command")
+	}, "", "whoami", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.EqualError(Execute(), "login: no session on stdin")
+	}, "", "login", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		e := Execute()
+		assert.EqualError(e, "login: the session has expired or is invalid, nothing is saved")
+		assert.Equal(ExitSessionExpired, ExitCode(e))
+		assert.NoFileExists(path)
+	}, "EXPIRED\n", "login", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("logged in as test@example.com, saved "+path+"\n", out.String())
+
+		fi, _ := os.Stat(path)
+		assert.Equal(os.FileMode(0600), fi.Mode().Perm())
+	}, "SESSION\n", "login", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("test@example.com (test)\n", out.String())
+	}, "", "whoami", "--backend", server.URL)
+
+	// --session over the saved one
+	execute(func(out b, err b) {
+		e := Execute()
+		assert.EqualError(e, "whoami: the session has expired or is invalid, log in again")
+		assert.Equal(ExitSessionExpired, ExitCode(e))
+	}, "", "whoami", "-s", "EXPIRED", "--backend", server.URL)
+
+	// Encrypted
+	t.Setenv("ONSENGO_PASSPHRASE", "secret")
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		b, _ := os.ReadFile(path)
+		assert.NotContains(string(b), "SESSION")
+	}, "", "login", "--encrypt", "-s", "SESSION", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("test@example.com (test)\n", out.String())
+	}, "", "whoami", "--backend", server.URL)
+
+	t.Setenv("ONSENGO_PASSPHRASE", "wrong")
+	execute(func(out b, err b) {
+		assert.EqualError(Execute(), "session: wrong passphrase")
+	}, "", "whoami", "--backend", server.URL)
+
+	// From stdin without ONSENGO_PASSPHRASE
+	os.Unsetenv("ONSENGO_PASSPHRASE")
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("test@example.com (test)\n", out.String())
+	}, "secret\n", "whoami", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("logged out, removed "+path+"\n", out.String())
+		assert.NoFileExists(path)
+	}, "", "logout")
+
+	execute(func(out b, err b) {
+		assert.EqualError(Execute(), "logout: not logged in")
+	}, "", "logout")
+}
+
+func TestCookies(t *testing.T) {
+	type b = *strings.Builder
+
+	var (
+		assert  = assert.New(t)
+		dir     = t.TempDir()
+		headers []string
+		server  = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			headers = append(headers, strings.Join(req.Header["Cookie"], "; "))
+			site := fakeSite("http://cdn")
+			if c, err := req.Cookie("_session_id"); err != nil || c.Value != "SESSION" {
+				site = strings.Replace(site, `"sign_in":`, `"sign_in":null,"_":`, 1)
+			}
+			fmt.Fprint(w, site)
+		}))
+
+		txt   = filepath.Join(dir, "cookies.txt")
+		js    = filepath.Join(dir, "cookies.json")
+		other = filepath.Join(dir, "other.txt")
+
+		execute = func(fn func(b, b), input ...string) {
+			out := root.out.(b)
+			err := root.err.(b)
+
+			root.oo, root.session, root.sessionRead, root.cookies = nil, "", false, ""
+			headers = nil
+			root.cmd.SetIn(strings.NewReader(""))
+			root.cmd.SetArgs(input)
+			fn(out, err)
+
+			out.Reset()
+			err.Reset()
+		}
+	)
+	defer server.Close()
+	defer func() { root.oo, root.session, root.sessionRead, root.cookies, root.client().Jar = nil, "", false, "", nil }()
+	defer root.cmd.SetIn(nil)
+
+	t.Setenv("XDG_CONFIG_HOME", dir)
+
+	os.WriteFile(txt, []byte("# Netscape HTTP Cookie File\n"+
+		"#HttpOnly_127.0.0.1\tFALSE\t/\tFALSE\t0\t_session_id\tSESSION\n"+
+		"127.0.0.1\tFALSE\t/\tFALSE\t0\tlocale\tja\n"+
+		".example.com\tTRUE\t/\tFALSE\t0\tother\t1\n"), 0600)
+	os.WriteFile(js, []byte(`[{"domain": "127.0.0.1", "hostOnly": true, "name": "_session_id", "value": "SESSION"}]`), 0600)
+	os.WriteFile(other, []byte(".example.com\tTRUE\t/\tFALSE\t0\t_session_id\tSESSION\n"), 0600)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("test@example.com (test)\n", out.String())
+		assert.Equal([]string{"_session_id=SESSION; locale=ja"}, headers)
+	}, "whoami", "--cookies", txt, "--backend", server.URL)
+
+	// The session in the cookies over --session
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal([]string{"_session_id=SESSION"}, headers)
+	}, "whoami", "--cookies", js, "-s", "EXPIRED", "--backend", server.URL)
+
+	// For other domains only
+	execute(func(out b, err b) {
+		assert.EqualError(Execute(), "whoami: no session, see the login command")
+	}, "whoami", "--cookies", other, "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.Equal(onsen.ErrSessionExpired, Execute())
+		assert.Equal([]string{"_session_id=EXPIRED"}, headers)
+	}, "lsm", "--cookies", other, "-s", "EXPIRED", "--backend", server.URL)
+
+	// Without --cookies, the jar is gone
+	execute(func(out b, err b) {
+		assert.EqualError(Execute(), "whoami: no session, see the login command")
+	}, "whoami", "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.NoError(Execute())
+		assert.Equal("logged in as test@example.com, saved "+filepath.Join(dir, "onsengo", "session.json")+"\n", out.String())
+	}, "login", "--cookies", txt, "--backend", server.URL)
+
+	execute(func(out b, err b) {
+		assert.Error(Execute())
+	}, "whoami", "--cookies", filepath.Join(dir, "nothing.txt"), "--backend", server.URL)
+}
+
+// Returns a minimal onsen.ag page with a radio "test" of 4 episodes, streaming from base/ID/playlist.m3u8
+// except the premium one which is inaccessible, and the first one is expiring. The signed-in user follows "test" and
+// a radio which doesn't exist.
+func fakeSite(base string) string {
+	const nuxt = `{"state":{
+	"sign_in":{"email":"test@example.com","uid":"test","favorite_performer_ids":[100],"favorite_program_ids":[1,2],
+		"playlisted_content_ids":[],"premium":"ios","subscription_ends_at":"11月15日",
+		"social_accounts":{"twitter":null,"facebook":null,"apple":{"uid":"test"}},
+		"user_listeneds":[
+			{"ongen_id":1010,"time_stop":-1,"watched":true},
+			{"ongen_id":1013,"time_stop":3723,"watched":false},
+			{"ongen_id":9999,"time_stop":10,"watched":false}
+		]},
+	"programs":{"programs":{"all":[{
+		"id":1,"directory_name":"test","title":"テスト","new":true,"updated":"11/7","delivery_day_of_week":[5],
+		"performers":[{"id":100,"name":"藤田茜"}],
+		"contents":[
+			{"id":10,"title":"第2回","program_id":1,"ongen_id":1010,"media_type":"sound","delivery_date":"11/7",
+			 "streaming_url":"%[1]s/10/playlist.m3u8","guests":[{"id":200,"name":"日高里菜"}]},
+			{"id":11,"title":"第1回","program_id":1,"ongen_id":1011,"media_type":"sound","delivery_date":"10/31",
+			 "streaming_url":"%[1]s/11/playlist.m3u8","guests":[],"expiring":true},
+			{"id":12,"title":"第1回 おまけ","program_id":1,"ongen_id":1012,"media_type":"sound","delivery_date":"10/31",
+			 "premium":true,"bonus":true,"streaming_url":null,"guests":[]},
+			{"id":13,"title":"特別編","program_id":1,"ongen_id":1013,"media_type":"sound","delivery_date":"10/24",
+			 "streaming_url":"%[1]s/13/playlist.m3u8","guests":[]}
+		]
+	}]}}}}`
+
+	return "<html><script>window.__NUXT__=(" + fmt.Sprintf(nuxt, base) + ");</script></html>"
+}
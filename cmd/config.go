@@ -0,0 +1,297 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var configCmd = struct {
+	cmd *cobra.Command
+}{
+	cmd: &cobra.Command{
+		Use:   "config",
+		Short: "Get and set defaults of options",
+		Long: `
+Options can be set in a config file instead of being passed on every call.
+The file is $XDG_CONFIG_HOME/onsengo/config.json, or
+~/.config/onsengo/config.json if XDG_CONFIG_HOME is not set, unless --config
+is given. Keys are names of global options, e.g.: backend, session, archive,
+output and format, or COMMAND.OPTION for options of a command, e.g.: get.jobs
+and serve.listen.
+
+An option is taken from the command line first, then the environment variable
+ONSENGO_KEY, where KEY is the key in upper case with "." and "-" replaced by
+"_", e.g.: ONSENGO_SESSION and ONSENGO_GET_JOBS, and then the config file.
+
+  onsengo config set output json
+  onsengo config set session < session.txt
+  onsengo config list
+`,
+	},
+}
+
+func init() {
+	root.cmd.AddCommand(configCmd.cmd)
+
+	configCmd.cmd.AddCommand(
+		&cobra.Command{
+			Use:   "list",
+			Short: "List the options set in the config file",
+			Args:  cobra.NoArgs,
+			RunE:  runConfigList,
+		},
+		&cobra.Command{
+			Use:   "get key",
+			Short: "Print the value of an option in the config file",
+			Args:  cobra.ExactArgs(1),
+			RunE:  runConfigGet,
+		},
+		&cobra.Command{
+			Use:   "set key [value]",
+			Short: "Set an option in the config file, the value is read from stdin if omitted",
+			Args:  cobra.RangeArgs(1, 2),
+			RunE:  runConfigSet,
+		},
+		&cobra.Command{
+			Use:   "unset key",
+			Short: "Remove an option from the config file",
+			Args:  cobra.ExactArgs(1),
+			RunE:  runConfigUnset,
+		},
+	)
+}
+
+// The config file, a JSON object of keys to values in strings.
+type config struct {
+	path   string
+	values map[string]string
+}
+
+// $XDG_CONFIG_HOME/onsengo, or ~/.config/onsengo.
+func configDir() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "onsengo"), nil
+}
+
+// Reads the config file, a missing file is an empty config.
+func loadConfig(path string) (*config, error) {
+	c := &config{path: path, values: make(map[string]string)}
+
+	b, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return c, nil
+	case err != nil:
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &c.values); err != nil {
+		return nil, fmt.Errorf("config: %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Writes the config file only readable by the user, for it may keep the session.
+func (c *config) save() error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(c.values, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+func (c *ctx) config() (*config, error) {
+	if c.conf == nil {
+		path := c.configFile
+		if path == "" {
+			dir, err := configDir()
+			if err != nil {
+				return nil, err
+			}
+			path = filepath.Join(dir, "config.json")
+		}
+		conf, err := loadConfig(path)
+		if err != nil {
+			return nil, err
+		}
+		c.conf = conf
+	}
+	return c.conf, nil
+}
+
+// The environment variable of a config key, e.g.: ONSENGO_GET_JOBS of get.jobs.
+func envKey(key string) string {
+	return "ONSENGO_" + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+// Looks up the flag of a config key, a global option or COMMAND.OPTION.
+func lookupConfigFlag(key string) (*pflag.Flag, error) {
+	var (
+		f       *pflag.Flag
+		name, o = "", key
+	)
+	if i := strings.Index(key, "."); i >= 0 {
+		name, o = key[:i], key[i+1:]
+	}
+
+	switch name {
+	case "":
+		f = root.cmd.PersistentFlags().Lookup(o)
+	default:
+		for _, c := range root.cmd.Commands() {
+			if c.Name() == name && c != configCmd.cmd {
+				f = c.NonInheritedFlags().Lookup(o)
+			}
+		}
+	}
+
+	if f == nil || o == "config" || o == "help" {
+		return nil, fmt.Errorf("config: unknown key %q, must be a global option or COMMAND.OPTION", key)
+	}
+	return f, nil
+}
+
+// Sets the options of the command not given on the command line from the environment and the config file.
+func (c *ctx) applyConfig(cmd *cobra.Command) error {
+	if cmd == configCmd.cmd || cmd.Parent() == configCmd.cmd {
+		return nil
+	}
+
+	conf, err := c.config()
+	if err != nil {
+		return err
+	}
+
+	apply := func(key string, f *pflag.Flag) error {
+		if f.Changed || f.Name == "config" || f.Name == "help" {
+			return nil
+		}
+		v, ok := os.LookupEnv(envKey(key))
+		if !ok {
+			v, ok = conf.values[key]
+		}
+		if !ok {
+			return nil
+		}
+		if err := f.Value.Set(v); err != nil {
+			return fmt.Errorf("config: %s: %w", key, err)
+		}
+		// Taken as given, e.g.: get.dir overrides the archive as -d does
+		f.Changed = true
+		return nil
+	}
+
+	var errs []error
+	root.cmd.PersistentFlags().VisitAll(func(f *pflag.Flag) {
+		if err := apply(f.Name, f); err != nil {
+			errs = append(errs, err)
+		}
+	})
+	if cmd != root.cmd {
+		cmd.NonInheritedFlags().VisitAll(func(f *pflag.Flag) {
+			if err := apply(cmd.Name()+"."+f.Name, f); err != nil {
+				errs = append(errs, err)
+			}
+		})
+	}
+	return errors.Join(errs...)
+}
+
+func runConfigList(cmd *cobra.Command, args []string) error {
+	conf, err := root.config()
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(conf.values))
+	for k := range conf.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Fprintf(root.outw(), "%s=%s\n", k, conf.values[k])
+	}
+	return nil
+}
+
+func runConfigGet(cmd *cobra.Command, args []string) error {
+	if _, err := lookupConfigFlag(args[0]); err != nil {
+		return err
+	}
+
+	conf, err := root.config()
+	if err != nil {
+		return err
+	}
+
+	v, ok := conf.values[args[0]]
+	if !ok {
+		return fmt.Errorf("config: %s is not set", args[0])
+	}
+	fmt.Fprintf(root.outw(), "%s\n", v)
+	return nil
+}
+
+func runConfigSet(cmd *cobra.Command, args []string) error {
+	if _, err := lookupConfigFlag(args[0]); err != nil {
+		return err
+	}
+
+	conf, err := root.config()
+	if err != nil {
+		return err
+	}
+
+	var v string
+	switch len(args) {
+	case 2:
+		v = args[1]
+	default:
+		// Keeps secrets like the session out of the shell history
+		if v, err = root.readSecret(args[0]); err != nil {
+			return fmt.Errorf("config: %w", err)
+		}
+	}
+
+	conf.values[args[0]] = v
+	return conf.save()
+}
+
+func runConfigUnset(cmd *cobra.Command, args []string) error {
+	conf, err := root.config()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := conf.values[args[0]]; !ok {
+		return fmt.Errorf("config: %s is not set", args[0])
+	}
+	delete(conf.values, args[0])
+	return conf.save()
+}
@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/adios/onsengo/onsen"
+	"github.com/adios/onsengo/snapshot"
+)
+
+var diff = struct {
+	cmd *cobra.Command
+}{
+	cmd: &cobra.Command{
+		Use:   "diff [old] [new]",
+		Short: "Show what changed between two states of Onsen website",
+		Long: `
+Compare two states of the website, each is a snapshot name in the store, or a
+path to a JSON file printed by the dump command. Without new, old is compared
+to the website. Without any, the latest snapshot is compared to the website.
+
+Each change is printed on a line:
+
+  + name title                   a radio show is added
+  - name title                   a radio show is removed
+  + name/id title                an episode is added
+  - name/id title                an episode is removed
+  ! name/id title (inaccessible) an episode becomes inaccessible
+  * name/id title (accessible)   an episode becomes accessible
+  $ name/id title (premium only) an episode becomes premium only
+  ~ name[/id] old -> new         a title is changed
+  ~ name hosts: old -> new       hosts of a radio show are changed
+`,
+		Args: cobra.MaximumNArgs(2),
+	},
+}
+
+func init() {
+	root.cmd.AddCommand(diff.cmd)
+
+	diff.cmd.Flags().StringVar(&snap.store, "store", "", "set snapshot directory")
+
+	diff.cmd.RunE = runDiff
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	t, err := root.template()
+	if err != nil {
+		return err
+	}
+
+	s, err := openStore()
+	if err != nil {
+		return err
+	}
+
+	var a, b *onsen.Onsen
+	switch len(args) {
+	case 0:
+		sn, ok, err := s.Latest()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("diff: no snapshot in %s, take one by the snapshot command", s.Dir())
+		}
+		if a, err = sn.Load(); err != nil {
+			return err
+		}
+	default:
+		if a, err = loadState(s, args[0]); err != nil {
+			return err
+		}
+	}
+
+	if len(args) == 2 {
+		b, err = loadState(s, args[1])
+	} else {
+		b, err = root.onsen()
+	}
+	if err != nil {
+		return err
+	}
+
+	cs := onsen.Diff(a, b)
+
+	switch {
+	case t != nil:
+		items := make([]interface{}, len(cs))
+		for i, c := range cs {
+			items[i] = newChangeData(c)
+		}
+		return writeTemplate(root.outw(), t, items)
+	case root.output != outputTable:
+		var (
+			models = make([]interface{}, len(cs))
+			rows   = make([][]string, len(cs))
+		)
+		for i, c := range cs {
+			m := newChangeModel(c)
+			models[i], rows[i] = m, m.row()
+		}
+		return writeModels(root.outw(), root.output, models, changeHeader, rows)
+	}
+
+	for _, c := range cs {
+		fmt.Fprintf(root.outw(), "%s\n", formatChange(c))
+	}
+
+	return nil
+}
+
+// Loads a state by the snapshot name, or the path of a JSON file.
+func loadState(s *snapshot.Store, arg string) (*onsen.Onsen, error) {
+	if sn, err := s.Get(arg); err == nil {
+		return sn.Load()
+	}
+	if _, err := os.Stat(arg); err != nil {
+		return nil, fmt.Errorf("diff: %s: neither a snapshot in %s nor a file", arg, s.Dir())
+	}
+	return snapshot.Load(arg)
+}
+
+func formatChange(c onsen.Change) string {
+	r, e := c.Radio.Name(), ""
+	if c.Episode.Raw != nil {
+		e = fmt.Sprintf("%s/%d", r, c.Episode.Id())
+	}
+
+	switch c.Kind {
+	case onsen.RadioAdded:
+		return fmt.Sprintf("+ %s %s", r, c.Radio.Title())
+	case onsen.RadioRemoved:
+		return fmt.Sprintf("- %s %s", r, c.Radio.Title())
+	case onsen.EpisodeAdded:
+		return fmt.Sprintf("+ %s %s", e, c.Episode.Title())
+	case onsen.EpisodeRemoved:
+		return fmt.Sprintf("- %s %s", e, c.Episode.Title())
+	case onsen.EpisodeInaccessible:
+		return fmt.Sprintf("! %s %s (inaccessible)", e, c.Episode.Title())
+	case onsen.EpisodeAccessible:
+		return fmt.Sprintf("* %s %s (accessible)", e, c.Episode.Title())
+	case onsen.EpisodePremium:
+		return fmt.Sprintf("$ %s %s (premium only)", e, c.Episode.Title())
+	case onsen.HostsChanged:
+		return fmt.Sprintf("~ %s hosts: %s -> %s", r, c.Old, c.New)
+	}
+	// onsen.TitleChanged
+	if e != "" {
+		r = e
+	}
+	return fmt.Sprintf("~ %s %s -> %s", r, c.Old, c.New)
+}
+
+type changeModel struct {
+	Kind      string `json:"kind"`
+	RadioId   int    `json:"radio_id"`
+	Radio     string `json:"radio"`
+	EpisodeId int    `json:"episode_id,omitempty"`
+	Title     string `json:"title"`
+	Old       string `json:"old,omitempty"`
+	New       string `json:"new,omitempty"`
+}
+
+var changeHeader = []string{"kind", "radio_id", "radio", "episode_id", "title", "old", "new"}
+
+func newChangeModel(c onsen.Change) changeModel {
+	m := changeModel{
+		Kind:    c.Kind,
+		RadioId: c.Radio.Id(),
+		Radio:   c.Radio.Name(),
+		Title:   c.Radio.Title(),
+		Old:     c.Old,
+		New:     c.New,
+	}
+	if c.Episode.Raw != nil {
+		m.EpisodeId = c.Episode.Id()
+		m.Title = c.Episode.Title()
+	}
+	return m
+}
+
+func (m changeModel) row() []string {
+	id := ""
+	if m.EpisodeId != 0 {
+		id = strconv.Itoa(m.EpisodeId)
+	}
+	return []string{m.Kind, strconv.Itoa(m.RadioId), m.Radio, id, m.Title, m.Old, m.New}
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/adios/onsengo/onsen"
+	pp "github.com/adios/pprint"
+)
+
+var featuring = struct {
+	filter filterFlags
+
+	cmd *cobra.Command
+}{
+	cmd: &cobra.Command{
+		Use:   "featuring [name...]",
+		Short: "List episodes featuring the people you follow",
+		Long: `
+List every episode hosted or guested by the people followed by the signed-in
+user, in ascending order on uploaded/published date. Provide names or ids to
+list those featuring the given people instead.
+
+  onsengo featuring -s SESSION --after 2021-10-01
+  onsengo featuring 藤田茜 小林裕介
+
+Inaccessible episodes are listed as well, see the letters as in ls.
+`,
+	},
+}
+
+func init() {
+	root.cmd.AddCommand(featuring.cmd)
+
+	featuring.cmd.RunE = runFeaturing
+	featuring.filter.bind(featuring.cmd)
+}
+
+func runFeaturing(cmd *cobra.Command, args []string) error {
+	o, err := root.onsen()
+	if err != nil {
+		return err
+	}
+
+	var ids []int
+	switch len(args) {
+	case 0:
+		u, ok := o.User()
+		if !ok {
+			return fmt.Errorf("featuring: no user signed in, set a session or provide names")
+		}
+		ids = u.FollowingPeople()
+	default:
+		for _, arg := range unique(args) {
+			a, ok := findPerson(o, arg)
+			if !ok {
+				fmt.Fprintf(root.errw(), "%s: not found\n", arg)
+				continue
+			}
+			ids = append(ids, a.Id())
+		}
+	}
+
+	f, err := featuring.filter.build(o)
+	if err != nil {
+		return err
+	}
+
+	var es []onsen.Episode
+	for _, e := range o.Featuring(ids...) {
+		if f.Pass(e) {
+			es = append(es, e)
+		}
+	}
+
+	lib, err := root.library()
+	if err != nil {
+		return err
+	}
+
+	t, err := root.template()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case t != nil:
+		items := make([]interface{}, len(es))
+		for i, e := range es {
+			items[i] = newEpisodeData(o, e)
+		}
+		return writeTemplate(root.outw(), t, items)
+	case root.output != outputTable:
+		models := make([]episodeModel, len(es))
+		for i, e := range es {
+			models[i] = newEpisodeModel(e, radioName(o, e))
+		}
+		return writeEpisodeModels(root.outw(), root.output, models)
+	}
+
+	var (
+		out = typeset()
+		l   = newLettering(lib)
+	)
+	for _, e := range es {
+		addEpisode(out, l, radioName(o, e), e)
+	}
+	pp.Print(out, pp.WithWriter(root.outw()))
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/adios/onsengo/archive"
+	"github.com/adios/onsengo/onsen"
+)
+
+var feed = struct {
+	baseUrl string
+
+	cmd *cobra.Command
+}{
+	cmd: &cobra.Command{
+		Use:   "feed radio_name",
+		Short: "Generate a podcast feed of a radio show",
+		Long: `
+Write an RSS 2.0 feed with iTunes tags of a radio show, to subscribe in
+podcast apps. Items are the episodes accessible with the current session,
+their enclosures point at the m3u8 manifests.
+
+  onsengo feed fujita > fujita.xml
+
+With --base-url, items are the archived episodes instead, enclosures point at
+the archived files under the URL. Serve the archive directory there with any
+web server:
+
+  onsengo feed fujita --archive ~/radio --base-url http://nas.local/radio/
+`,
+	},
+}
+
+func init() {
+	root.cmd.AddCommand(feed.cmd)
+
+	feed.cmd.RunE = runFeed
+	feed.cmd.Args = cobra.ExactArgs(1)
+	feed.cmd.Flags().StringVar(&feed.baseUrl, "base-url", "", "point enclosures at archived files under this URL")
+}
+
+func runFeed(cmd *cobra.Command, args []string) error {
+	o, err := root.onsen()
+	if err != nil {
+		return err
+	}
+
+	r, ok := o.Radio(args[0])
+	if !ok {
+		return fmt.Errorf("%s: not found", args[0])
+	}
+
+	var opts []onsen.FeedOpt
+	if feed.baseUrl != "" {
+		lib, err := root.library()
+		if err != nil {
+			return err
+		}
+		if lib == nil {
+			return fmt.Errorf("feed: --base-url requires --archive")
+		}
+		opts = append(opts, onsen.WithEnclosure(archiveEnclosure(lib, feed.baseUrl)))
+	}
+
+	return onsen.Feed(root.outw(), r, opts...)
+}
+
+// Encloses the archived file of an episode under the base URL. Files outside of the archive are not served, hence
+// not enclosed.
+func archiveEnclosure(lib *archive.Library, base string) func(onsen.Episode) (onsen.Enclosure, bool) {
+	base = strings.TrimSuffix(base, "/") + "/"
+
+	return func(e onsen.Episode) (onsen.Enclosure, bool) {
+		a, ok := lib.Get(e.Id())
+		if !ok || filepath.IsAbs(a.Path) || !lib.Has(e.Id()) {
+			return onsen.Enclosure{}, false
+		}
+
+		u := url.URL{Path: filepath.ToSlash(a.Path)}
+		return onsen.Enclosure{
+			URL:    base + u.EscapedPath(),
+			Length: a.Size,
+			Type:   mediaType(a.Path),
+		}, true
+	}
+}
+
+func mediaType(path string) string {
+	switch filepath.Ext(path) {
+	case ".m4a":
+		return "audio/mp4"
+	case ".mp4":
+		return "video/mp4"
+	case ".aac":
+		return "audio/aac"
+	case ".ts":
+		return "video/mp2t"
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,320 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/adios/onsengo/archive"
+	"github.com/adios/onsengo/hls"
+	"github.com/adios/onsengo/onsen"
+	"github.com/adios/onsengo/remux"
+)
+
+var get = struct {
+	dl     downloadFlags
+	filter filterFlags
+
+	cmd *cobra.Command
+}{
+	cmd: &cobra.Command{
+		Use:   "get [radio_name...] [radio_name/episode_id...]",
+		Short: "Download episodes",
+		Long: `
+Download episodes into files. Arguments are the same as lsm: pass radio names
+to download all the accessible episodes of those radio shows, or name-id
+formats to download the specified episodes.
+
+  onsengo get fujita/3919             # download an episode
+  onsengo get fujita -d ~/radio       # download a radio show into ~/radio
+  onsengo get --after 2020-12-27      # download those updated on or after 2020/12/27 in JST
+
+The variant with the highest bandwidth is chosen, all of its segments are
+downloaded and remuxed into RADIO_NAME-EPISODE_ID.m4a, or .mp4 for episodes
+with video. Titles, hosts, guests and the date are written as tags. Use --raw
+to keep the stream as it is, a .ts (or .aac) file. Episodes expiring soon are
+downloaded first.
+
+Segments are downloaded in parallel into a FILE.parts directory and recorded
+in a FILE.journal next to the output. If a download is interrupted, running
+the same command again resumes it, skipping the completed segments. Files
+already downloaded are skipped.
+
+With --archive, files are saved into the archive directory unless -d is
+given, and every download is recorded in its index. Archived episodes are
+verified against their checksums and skipped, a mismatched one is downloaded
+again.
+
+  onsengo get fujita --archive ~/radio
+`,
+	},
+}
+
+func init() {
+	root.cmd.AddCommand(get.cmd)
+
+	get.cmd.RunE = runGet
+	// Failures are reported per episode, don't bury them under the usage.
+	get.cmd.SilenceUsage = true
+	get.dl.bind(get.cmd)
+	get.filter.bind(get.cmd)
+}
+
+func runGet(cmd *cobra.Command, args []string) error {
+	o, err := root.onsen()
+	if err != nil {
+		return err
+	}
+
+	lib, err := root.library()
+	if err != nil {
+		return err
+	}
+
+	f, err := get.filter.build(o)
+	if err != nil {
+		return err
+	}
+	pushArgs(o, f, args)
+
+	es := make([]onsen.Episode, 0, len(f.Episodes()))
+	for _, e := range f.Episodes() {
+		es = append(es, e.(onsen.Episode))
+	}
+
+	if failed := get.dl.run(cmd, o, lib, es); failed > 0 {
+		return fmt.Errorf("get: %d episode(s) failed", failed)
+	}
+	return nil
+}
+
+// Flags of commands which download episodes.
+type downloadFlags struct {
+	dir     string
+	raw     bool
+	jobs    int
+	retries int
+	backoff time.Duration
+}
+
+func (df *downloadFlags) bind(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&df.dir, "dir", "d", ".", "save files into this directory, defaults to the archive if set")
+	cmd.Flags().BoolVar(&df.raw, "raw", false, "keep the downloaded stream without remuxing")
+	cmd.Flags().IntVarP(&df.jobs, "jobs", "j", 4, "number of segments to download in parallel")
+	cmd.Flags().IntVar(&df.retries, "retries", 3, "number of retries for a failed request")
+	cmd.Flags().DurationVar(&df.backoff, "backoff", time.Second, "wait before the first retry, doubled on each retry")
+}
+
+// Downloads the episodes one after another, prints the paths of saved files and reports the failures to stderr.
+// Returns the number of failed episodes.
+func (df *downloadFlags) run(cmd *cobra.Command, o *onsen.Onsen, lib *archive.Library, es []onsen.Episode) int {
+	dir := df.dir
+	if lib != nil && !cmd.Flags().Changed("dir") {
+		dir = lib.Dir()
+	}
+
+	es = byExpiry(es)
+
+	var (
+		d = hls.NewDownloader(
+			root.get,
+			hls.WithJobs(df.jobs),
+			hls.WithRetry(df.retries, df.backoff),
+		)
+		failed int
+	)
+	for _, e := range es {
+		if path, ok := archived(lib, o, e); ok {
+			fmt.Fprintf(root.outw(), "%s\n", path)
+			continue
+		}
+
+		path, err := download(o, d, e, dir, df.raw)
+		if err == nil {
+			err = record(lib, o, e, path)
+		}
+		if err != nil {
+			fmt.Fprintf(root.errw(), "%s: %s\n", episodeName(o, e), err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(root.outw(), "%s\n", path)
+	}
+	return failed
+}
+
+// Returns a copy of the episodes with the expiring ones moved to the front, so they are downloaded before they
+// disappear.
+func byExpiry(es []onsen.Episode) []onsen.Episode {
+	out := make([]onsen.Episode, len(es))
+	copy(out, es)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].IsExpiring() && !out[j].IsExpiring() })
+	return out
+}
+
+// Downloads the episode into dir, returns the path to the saved file. The stream is remuxed into .m4a/.mp4 unless
+// raw is set.
+func download(o *onsen.Onsen, d *hls.Downloader, e onsen.Episode, dir string, raw bool) (string, error) {
+	var (
+		name = filepath.Join(dir, episodeFilename(o, e))
+		path = name + mediaExt(e)
+	)
+	// A remuxed file is told without the playlist, saving the request, and it's kept even if the manifest is gone.
+	if !raw && completed(path) {
+		fmt.Fprintf(root.errw(), "%s: %s exists, skipped\n", episodeName(o, e), path)
+		return path, nil
+	}
+
+	m, _ := e.Manifest()
+
+	p, err := d.Playlist(m)
+	if err != nil {
+		return "", err
+	}
+
+	stream := name + p.Ext()
+	if raw {
+		path = stream
+		if completed(path) {
+			fmt.Fprintf(root.errw(), "%s: %s exists, skipped\n", episodeName(o, e), path)
+			return path, nil
+		}
+	}
+
+	// The stream may be left by an earlier run which failed to remux.
+	if !completed(stream) {
+		if err := d.DownloadFile(p, stream); err != nil {
+			return "", err
+		}
+	}
+	if raw {
+		return path, nil
+	}
+
+	if err := remuxFile(stream, path, metadata(o, e)); err != nil {
+		return "", err
+	}
+	return path, os.Remove(stream)
+}
+
+// Returns the path of an archived episode if its file is verified. A file failed the verification is removed to be
+// downloaded again.
+func archived(lib *archive.Library, o *onsen.Onsen, e onsen.Episode) (string, bool) {
+	if lib == nil {
+		return "", false
+	}
+	a, ok := lib.Get(e.Id())
+	if !ok {
+		return "", false
+	}
+
+	path := lib.Abs(a)
+	if err := lib.Verify(e.Id()); err != nil {
+		fmt.Fprintf(root.errw(), "%s: %s, downloading again\n", episodeName(o, e), err)
+		os.Remove(path)
+		return "", false
+	}
+	fmt.Fprintf(root.errw(), "%s: archived as %s, skipped\n", episodeName(o, e), path)
+	return path, true
+}
+
+// Adds the downloaded episode into the archive, if any.
+func record(lib *archive.Library, o *onsen.Onsen, e onsen.Episode, path string) error {
+	if lib == nil {
+		return nil
+	}
+	tm, _ := e.JstUpdatedAt()
+
+	return lib.Add(archive.Entry{
+		Id:      e.Id(),
+		RadioId: e.RadioId(),
+		Radio:   radioName(o, e),
+		Title:   e.Title(),
+		Date:    tm,
+		Path:    path,
+	})
+}
+
+// An output without journal is a completed download.
+func completed(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil && !hls.HasJournal(path)
+}
+
+func remuxFile(src, dst string, meta remux.Metadata) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + ".part"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := remux.Remux(out, in, meta); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// The tags of the remuxed file.
+func metadata(o *onsen.Onsen, e onsen.Episode) remux.Metadata {
+	meta := remux.Metadata{Title: e.Title()}
+
+	if r, ok := o.Radio(e.RadioId()); ok {
+		meta.Album = r.Title()
+		for _, p := range r.Hosts() {
+			meta.Artists = append(meta.Artists, p.Name())
+		}
+	}
+	if tm, ok := e.JstUpdatedAt(); ok {
+		meta.Date = tm
+	}
+	if gs := e.Guests(); len(gs) > 0 {
+		names := make([]string, len(gs))
+		for i, p := range gs {
+			names[i] = p.Name()
+		}
+		meta.Comment = "Guests: " + strings.Join(names, ", ")
+	}
+	return meta
+}
+
+func mediaExt(e onsen.Episode) string {
+	if e.HasVideoStream() {
+		return ".mp4"
+	}
+	return ".m4a"
+}
+
+// Returns the episode in name-id format, e.g.: fujita/3919
+func episodeName(o *onsen.Onsen, e onsen.Episode) string {
+	return radioName(o, e) + "/" + strconv.Itoa(e.Id())
+}
+
+// Returns a filename without extension for the episode, e.g.: fujita-3919
+func episodeFilename(o *onsen.Onsen, e onsen.Episode) string {
+	return radioName(o, e) + "-" + strconv.Itoa(e.Id())
+}
+
+func radioName(o *onsen.Onsen, e onsen.Episode) string {
+	r, ok := o.Radio(e.RadioId())
+	if !ok {
+		return strconv.Itoa(e.RadioId())
+	}
+	return r.Name()
+}
@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/adios/onsengo/onsen"
+	"github.com/adios/onsengo/session"
+)
+
+var login = struct {
+	encrypt bool
+	cmd     *cobra.Command
+}{
+	cmd: &cobra.Command{
+		Use:   "login",
+		Short: "Save the session for later commands",
+		Long: `
+Check the session is signed in on the website, and save it into a file only
+readable by the user, so later commands don't need --session. The session is
+taken from --cookies, --session, or asked for on the terminal, or read from
+stdin.
+
+The file is $XDG_CONFIG_HOME/onsengo/session.json, or
+~/.config/onsengo/session.json. With --encrypt, it is encrypted with a
+passphrase, which is asked for on the terminal or taken from
+ONSENGO_PASSPHRASE, both when saving and when using the session.
+
+A session given by --session, ONSENGO_SESSION or the config file takes
+precedence over the saved one.
+`,
+		Args: cobra.NoArgs,
+	},
+}
+
+var logout = struct {
+	cmd *cobra.Command
+}{
+	cmd: &cobra.Command{
+		Use:   "logout",
+		Short: "Remove the session saved by login",
+		Args:  cobra.NoArgs,
+	},
+}
+
+var whoami = struct {
+	cmd *cobra.Command
+}{
+	cmd: &cobra.Command{
+		Use:   "whoami",
+		Short: "Check the session is still signed in",
+		Long: `
+Request the website with the session, and print the email and the uid of the
+user signed in. It fails if there is no session, or the session has expired.
+`,
+		Args: cobra.NoArgs,
+	},
+}
+
+func init() {
+	root.cmd.AddCommand(login.cmd, logout.cmd, whoami.cmd)
+
+	login.cmd.Flags().BoolVar(&login.encrypt, "encrypt", false, "encrypt the session file with a passphrase")
+
+	login.cmd.RunE = runLogin
+	logout.cmd.RunE = runLogout
+	whoami.cmd.RunE = runWhoami
+}
+
+func runLogin(cmd *cobra.Command, args []string) error {
+	path, err := sessionPath()
+	if err != nil {
+		return err
+	}
+
+	sid, ok := root.cookieSession()
+	switch {
+	case ok:
+	case root.session != "":
+		sid = root.session
+	default:
+		if sid, err = root.readSecret("session"); err != nil {
+			return fmt.Errorf("login: %w", err)
+		}
+	}
+	// Not to read the saved session instead
+	root.session, root.sessionRead, root.oo = sid, true, nil
+
+	o, err := root.onsen()
+	if errors.Is(err, onsen.ErrSessionExpired) {
+		return fmt.Errorf("login: %w, nothing is saved", err)
+	}
+	if err != nil {
+		return err
+	}
+	u, ok := o.User()
+	if !ok {
+		return fmt.Errorf("login: %w, nothing is saved", onsen.ErrSessionExpired)
+	}
+
+	var passphrase string
+	if login.encrypt {
+		if passphrase, err = root.newPassphrase(); err != nil {
+			return fmt.Errorf("login: %w", err)
+		}
+	}
+
+	if err := session.Save(path, sid, passphrase); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(root.outw(), "logged in as %s, saved %s\n", u.Email(), path)
+
+	return nil
+}
+
+func runLogout(cmd *cobra.Command, args []string) error {
+	path, err := sessionPath()
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("logout: not logged in")
+	case err != nil:
+		return err
+	}
+
+	fmt.Fprintf(root.outw(), "logged out, removed %s\n", path)
+
+	return nil
+}
+
+func runWhoami(cmd *cobra.Command, args []string) error {
+	ok, err := root.hasSession()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("whoami: no session, see the login command")
+	}
+
+	o, err := root.onsen()
+	if errors.Is(err, onsen.ErrSessionExpired) {
+		return fmt.Errorf("whoami: %w, log in again", err)
+	}
+	if err != nil {
+		return err
+	}
+	u, ok := o.User()
+	if !ok {
+		return fmt.Errorf("whoami: %w, log in again", onsen.ErrSessionExpired)
+	}
+
+	fmt.Fprintf(root.outw(), "%s (%s)\n", u.Email(), u.Uid())
+
+	return nil
+}
+
+// $XDG_CONFIG_HOME/onsengo/session.json, or ~/.config/onsengo/session.json.
+func sessionPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "session.json"), nil
+}
+
+// Returns the session of --session, or the one saved by login, empty if neither.
+func (c *ctx) sessionId() (string, error) {
+	if c.session != "" || c.sessionRead {
+		return c.session, nil
+	}
+	c.sessionRead = true
+
+	path, err := sessionPath()
+	if err != nil {
+		return "", err
+	}
+
+	s, err := session.Load(path, c.passphrase)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return "", nil
+	case err != nil:
+		return "", fmt.Errorf("session: %w", err)
+	}
+	c.session = s
+	return s, nil
+}
+
+// The passphrase of the session file from ONSENGO_PASSPHRASE, or asked for.
+func (c *ctx) passphrase() (string, error) {
+	if p, ok := os.LookupEnv("ONSENGO_PASSPHRASE"); ok {
+		return p, nil
+	}
+	return c.readSecret("passphrase")
+}
+
+// Asks for a passphrase twice on the terminal, or takes it from ONSENGO_PASSPHRASE.
+func (c *ctx) newPassphrase() (string, error) {
+	p, err := c.passphrase()
+	if err != nil {
+		return "", err
+	}
+	if p == "" {
+		return "", fmt.Errorf("empty passphrase")
+	}
+
+	if _, ok := os.LookupEnv("ONSENGO_PASSPHRASE"); ok || !c.isTerminal() {
+		return p, nil
+	}
+	again, err := c.readSecret("passphrase again")
+	if err != nil {
+		return "", err
+	}
+	if p != again {
+		return "", fmt.Errorf("passphrases don't match")
+	}
+	return p, nil
+}
+
+func (c *ctx) isTerminal() bool {
+	f, ok := c.cmd.InOrStdin().(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// Asks for a secret on the terminal without echo, or reads a line from stdin.
+func (c *ctx) readSecret(name string) (string, error) {
+	if c.isTerminal() {
+		fmt.Fprintf(c.errw(), "%s: ", name)
+		b, err := term.ReadPassword(int(c.cmd.InOrStdin().(*os.File).Fd()))
+		fmt.Fprintln(c.errw())
+		return string(b), err
+	}
+
+	if c.in == nil {
+		c.in = bufio.NewReader(c.cmd.InOrStdin())
+	}
+	line, err := c.in.ReadString('\n')
+	if line == "" && err != nil {
+		return "", fmt.Errorf("no %s on stdin", name)
+	}
+	return strings.TrimSpace(line), nil
+}
@@ -2,22 +2,26 @@ package cmd
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
+	"text/template"
 	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/adios/onsengo/archive"
 	"github.com/adios/onsengo/onsen"
 	pp "github.com/adios/pprint"
 )
 
 var ls = struct {
 	recursive bool
+	filter    filterFlags
 
 	cmd *cobra.Command
 
-	// map for translating boolean to ls letters
-	lut letters
+	// whether an episode passes the filter flags
+	pass FilterFn
 }{
 	cmd: &cobra.Command{
 		Use:   "ls [radio_name...]",
@@ -27,6 +31,12 @@ List and browse radio shows, outputs in ascending order on uploaded/published
 date. Provide radio names to list only those shows including their episodes.
 
 Use -r to list all radio shows and their episodes.
+
+Use --after, --before, --on, --since, --weekday and --where to list only the
+episodes matching them, as in lsm, radio shows without such episodes are left
+out:
+
+  onsengo ls -r --where 'guest~"日高"'
 `,
 	},
 }
@@ -36,6 +46,7 @@ func init() {
 
 	ls.cmd.RunE = runLs
 	ls.cmd.Flags().BoolVarP(&ls.recursive, "recursive", "r", false, "include all episodes")
+	ls.filter.bind(ls.cmd)
 }
 
 func runLs(cmd *cobra.Command, args []string) error {
@@ -44,36 +55,123 @@ func runLs(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	setupLs()
+	f, err := ls.filter.build(o)
+	if err != nil {
+		return err
+	}
+	ls.pass = f.Pass
 
-	out := typeset()
+	lib, err := root.library()
+	if err != nil {
+		return err
+	}
+
+	t, err := root.template()
+	if err != nil {
+		return err
+	}
 
-	switch n := len(args); {
-	case n == 0:
-		if ls.recursive {
-			o.EachRadio(func(r onsen.Radio) { addRadioEpisodes(out, r) })
+	switch {
+	case t != nil:
+		return formatLs(o, args, t)
+	case root.output != outputTable:
+		return writeLs(o, args)
+	}
+
+	var (
+		out = typeset()
+		l   = newLettering(lib)
+	)
+	for _, r := range lsRadios(o, args) {
+		if ls.recursive || len(args) > 0 {
+			addRadioEpisodes(out, l, r, lsEpisodes(r))
 		} else {
-			o.EachRadio(func(r onsen.Radio) { addRadio(out, r) })
+			addRadio(out, l, r, len(lsEpisodes(r)))
+		}
+	}
+
+	// 0, 1, 2: letters, count, mtime ...
+	if err := out.Sort(2, pp.WithCmpMatchers(mtimeCmp)); err != nil {
+		return err
+	}
+
+	pp.Print(out, pp.WithWriter(root.outw()))
+
+	return nil
+}
+
+// Writes the same radios and episodes as the table in the structured output format.
+func writeLs(o *onsen.Onsen, args []string) error {
+	var (
+		rs           = lsRadios(o, args)
+		withEpisodes = ls.recursive || len(args) > 0
+		models       = make([]radioModel, len(rs))
+	)
+	for i, r := range rs {
+		models[i] = newRadioModel(r, false)
+		es := lsEpisodes(r)
+		// The count of the episodes passing the filter, as the table
+		models[i].Count = len(es)
+		if !withEpisodes {
+			continue
+		}
+		models[i].Episodes = make([]episodeModel, len(es))
+		for j, e := range es {
+			models[i].Episodes[j] = newEpisodeModel(e, r.Name())
 		}
-	case n > 0:
+	}
+	return writeRadioModels(root.outw(), root.output, models, withEpisodes)
+}
+
+// Executes the template on every radio, or every episode if they are listed.
+func formatLs(o *onsen.Onsen, args []string, t *template.Template) error {
+	var items []interface{}
+	for _, r := range lsRadios(o, args) {
+		if !ls.recursive && len(args) == 0 {
+			items = append(items, newRadioData(r))
+			continue
+		}
+		for _, e := range lsEpisodes(r) {
+			items = append(items, newEpisodeData(o, e))
+		}
+	}
+	return writeTemplate(root.outw(), t, items)
+}
+
+// Returns the radios designated by args, or all radios if no args, in the same order as the table. Radios without
+// episodes passing the filter are left out if any of the filter flags is set.
+func lsRadios(o *onsen.Onsen, args []string) []onsen.Radio {
+	var rs []onsen.Radio
+	switch len(args) {
+	case 0:
+		rs = o.Radios()
+	default:
 		for _, arg := range unique(args) {
 			r, ok := o.Radio(arg)
 			if !ok {
 				fmt.Fprintf(root.errw(), "%s: not found\n", arg)
 				continue
 			}
-			addRadioEpisodes(out, r)
+			rs = append(rs, r)
 		}
 	}
 
-	// 0, 1, 2: letters, count, mtime ...
-	if err := out.Sort(2, pp.WithCmpMatchers(mtimeCmp)); err != nil {
-		return err
+	if ls.filter.isSet() {
+		filtered := rs[:0]
+		for _, r := range rs {
+			if len(lsEpisodes(r)) > 0 {
+				filtered = append(filtered, r)
+			}
+		}
+		rs = filtered
 	}
 
-	pp.Print(out, pp.WithWriter(root.outw()))
-
-	return nil
+	sort.SliceStable(rs, func(i, j int) bool {
+		a, _ := rs[i].JstUpdatedAt()
+		b, _ := rs[j].JstUpdatedAt()
+		return a.Before(b)
+	})
+	return rs
 }
 
 // Returns the pushed node to create folder-like context to further push episodes to it.
@@ -86,13 +184,13 @@ func runLs(cmd *cobra.Command, args []string) error {
 //   - radio name
 //   - ...
 //
-// Sort on output (root level) affects only on "radio name" level.
-func addRadio(out *pp.Node, r onsen.Radio) (pushed *pp.Node) {
+// Sort on output (root level) affects only on "radio name" level. n is the count of episodes shown in the row.
+func addRadio(out *pp.Node, l lettering, r onsen.Radio, n int) (pushed *pp.Node) {
 	tm, _ := r.JstUpdatedAt()
 
 	pushed, _ = out.Push(
-		toRadioLetters(r),
-		len(r.Episodes()),
+		l.radio(r),
+		n,
 		mtime(tm),
 		r.Name(),
 		r.Title(),
@@ -101,53 +199,48 @@ func addRadio(out *pp.Node, r onsen.Radio) (pushed *pp.Node) {
 	return pushed
 }
 
-func addRadioEpisodes(out *pp.Node, r onsen.Radio) {
-	var (
-		// Push radio first
-		dir     = addRadio(out, r)
-		dirName = r.Name()
-	)
-
-	// And then push every episodes under that radio
+// Returns the episodes of the radio passing the filter flags.
+func lsEpisodes(r onsen.Radio) []onsen.Episode {
+	var out []onsen.Episode
 	for _, e := range r.Episodes() {
-		tm, _ := e.JstUpdatedAt()
-
-		// Append guests to radio episode title
-		last := e.Title()
-		if len(e.Guests()) != 0 {
-			last += " #"
-
-			for _, p := range e.Guests() {
-				last += " " + p.Name()
-			}
+		if ls.pass(e) {
+			out = append(out, e)
 		}
-
-		dir.Push(
-			toEpisodeLetters(e),
-			1,
-			mtime(tm),
-			dirName+"/"+strconv.FormatInt(int64(e.Id()), 10),
-			last,
-		)
 	}
+	return out
 }
 
-func toRadioLetters(r onsen.Radio) string {
-	return "d--" + ls.lut["just updated"][r.HasBeenUpdated()] + "--"
+func addRadioEpisodes(out *pp.Node, l lettering, r onsen.Radio, es []onsen.Episode) {
+	// Push radio first
+	dir := addRadio(out, l, r, len(es))
+
+	// And then push the episodes under that radio
+	for _, e := range es {
+		addEpisode(dir, l, r.Name(), e)
+	}
 }
 
-func toEpisodeLetters(e onsen.Episode) string {
-	var (
-		m    = ls.lut
-		u, _ = e.Manifest()
-	)
+// Pushes an episode of the radio named dirName.
+func addEpisode(dir *pp.Node, l lettering, dirName string, e onsen.Episode) {
+	tm, _ := e.JstUpdatedAt()
 
-	return "-" +
-		m["accessible"][u != ""] +
-		m["include video"][e.HasVideoStream()] +
-		m["just updated"][e.IsLatest()] +
-		m["extra content"][e.IsBonus()] +
-		m["paid content"][e.RequiresPremium()]
+	// Append guests to radio episode title
+	last := e.Title()
+	if len(e.Guests()) != 0 {
+		last += " #"
+
+		for _, p := range e.Guests() {
+			last += " " + p.Name()
+		}
+	}
+
+	dir.Push(
+		l.episode(e),
+		1,
+		mtime(tm),
+		dirName+"/"+strconv.FormatInt(int64(e.Id()), 10),
+		last,
+	)
 }
 
 func typeset() *pp.Node {
@@ -176,32 +269,85 @@ func mtimeCmp(a interface{}) pp.CmpFn {
 	}
 }
 
+// Maps a boolean to its letter, for each of the ls letters.
 type letters map[string]map[bool]string
 
-func setupLs() {
-	ls.lut = letters{
-		"accessible": {
-			true:  "r",
-			false: "-",
-		},
-		"include video": {
-			true:  "v",
-			false: "-",
-		},
-		"just updated": {
-			true:  "*",
-			false: "-",
-		},
-		"extra content": {
-			true:  "+",
-			false: "-",
-		},
-		"paid content": {
-			true:  "$",
-			false: "-",
-		},
+var lsLetters = letters{
+	"accessible": {
+		true:  "r",
+		false: "-",
+	},
+	"include video": {
+		true:  "v",
+		false: "-",
+	},
+	"just updated": {
+		true:  "*",
+		false: "-",
+	},
+	"extra content": {
+		true:  "+",
+		false: "-",
+	},
+	"paid content": {
+		true:  "$",
+		false: "-",
+	},
+	"archived": {
+		true:  "a",
+		false: "-",
+	},
+	"expiring": {
+		true:  "!",
+		false: "-",
+	},
+}
+
+// The letter of the media type of an episode, "-" if unknown.
+func mediaLetter(mediaType string) string {
+	switch mediaType {
+	case "sound":
+		return "s"
+	case "movie":
+		return "m"
+	}
+	return "-"
+}
+
+// Translates radios and episodes to the ls letters, e.g.: -r-s*---- for an accessible sound episode just updated.
+type lettering struct {
+	// whether an episode is in the archive
+	archived func(id int) bool
+}
+
+// The archive is optional, no episodes are archived without it.
+func newLettering(lib *archive.Library) lettering {
+	l := lettering{archived: func(int) bool { return false }}
+	if lib != nil {
+		l.archived = lib.Has
 	}
+	return l
+}
+
+func (l lettering) radio(r onsen.Radio) string {
+	return "d---" + lsLetters["just updated"][r.HasBeenUpdated()] + "---" + lsLetters["expiring"][r.IsExpiring()]
+}
+
+func (l lettering) episode(e onsen.Episode) string {
+	var (
+		m    = lsLetters
+		u, _ = e.Manifest()
+	)
 
+	return "-" +
+		m["accessible"][u != ""] +
+		m["include video"][e.HasVideoStream()] +
+		mediaLetter(e.MediaType()) +
+		m["just updated"][e.IsLatest()] +
+		m["extra content"][e.IsBonus()] +
+		m["paid content"][e.RequiresPremium()] +
+		m["archived"][l.archived(e.Id())] +
+		m["expiring"][e.IsExpiring()]
 }
 
 // Stable unique.
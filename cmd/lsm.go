@@ -12,7 +12,7 @@ import (
 )
 
 var lsm = struct {
-	after JstHyphenDate
+	filter filterFlags
 
 	cmd *cobra.Command
 }{
@@ -27,6 +27,7 @@ specified manifest.
   onsengo lsm fujita             # list all manifests for a radio show
   onsengo lsm fujita/3919        # show specified episode
   onsengo lsm --after 2020-12-27 # list those updated on or after 2020/12/27 in JST
+  onsengo lsm --since last-friday --weekday fri
 
 Note that inaccessible episodes are not shown. 
 `,
@@ -37,7 +38,7 @@ func init() {
 	root.cmd.AddCommand(lsm.cmd)
 
 	lsm.cmd.RunE = runLsm
-	lsm.cmd.Flags().Var(&lsm.after, "after", "show only those that are on or after this date (in JST)")
+	lsm.filter.bind(lsm.cmd)
 }
 
 func runLsm(cmd *cobra.Command, args []string) error {
@@ -46,12 +47,45 @@ func runLsm(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	// filtering on these cases: empty manifest, on-air before a given date
-	f := NewFilter()
-	if lsm.after != (JstHyphenDate{}) {
-		f.With(FilterUpdatedAfter(time.Time(lsm.after)))
+	// filtering on these cases: empty manifest, on-air before a given date, --where
+	f, err := lsm.filter.build(o)
+	if err != nil {
+		return err
+	}
+	pushArgs(o, f, args)
+
+	t, err := root.template()
+	if err != nil {
+		return err
+	}
+	if t != nil {
+		items := make([]interface{}, 0, len(f.Episodes()))
+		for _, e := range f.Episodes() {
+			items = append(items, newEpisodeData(o, e.(onsen.Episode)))
+		}
+		return writeTemplate(root.outw(), t, items)
+	}
+
+	if root.output != outputTable {
+		es := make([]episodeModel, 0, len(f.Episodes()))
+		for _, e := range f.Episodes() {
+			e := e.(onsen.Episode)
+			es = append(es, newEpisodeModel(e, radioName(o, e)))
+		}
+		return writeEpisodeModels(root.outw(), root.output, es)
+	}
+
+	out := root.outw()
+	for _, m := range f.Out() {
+		fmt.Fprintf(out, "%s\n", m)
 	}
 
+	return nil
+}
+
+// Pushes the episodes designated by args to the filter. An arg is either a radio name or in name-id format, no args
+// means all the episodes.
+func pushArgs(o *onsen.Onsen, f *Filter, args []string) {
 	switch n := len(args); {
 	case n == 0:
 		o.EachRadio(func(r onsen.Radio) {
@@ -79,13 +113,6 @@ func runLsm(cmd *cobra.Command, args []string) error {
 			}
 		}
 	}
-
-	out := root.outw()
-	for _, m := range f.Out() {
-		fmt.Fprintf(out, "%s\n", m)
-	}
-
-	return nil
 }
 
 func processDesignatedEpisode(o *onsen.Onsen, f *Filter, id int, name string) {
@@ -108,6 +135,7 @@ type (
 	// input episodes. It stores all the manifests of the episodes that passed the filtering.
 	Filter struct {
 		q     []string
+		es    []Episoder
 		chain []FilterFn
 	}
 
@@ -116,17 +144,23 @@ type (
 
 	Episoder interface {
 		Id() int
+		RadioId() int
+		Title() string
+		Guests() []onsen.Person
 		JstUpdatedAt() (time.Time, bool)
 		Manifest() (string, bool)
+		RequiresPremium() bool
+		IsBonus() bool
+		HasVideoStream() bool
+		IsLatest() bool
+		IsExpiring() bool
 	}
 )
 
 // Takes an episode to run through the filter chain.
 func (f *Filter) Push(e Episoder) {
-	for _, pass := range f.chain {
-		if !pass(e) {
-			return
-		}
+	if !f.Pass(e) {
+		return
 	}
 
 	m, ok := e.Manifest()
@@ -135,12 +169,28 @@ func (f *Filter) Push(e Episoder) {
 	}
 
 	f.q = append(f.q, m)
+	f.es = append(f.es, e)
+}
+
+// Runs the filter chain on an episode without storing it, inaccessible episodes may pass.
+func (f *Filter) Pass(e Episoder) bool {
+	for _, pass := range f.chain {
+		if !pass(e) {
+			return false
+		}
+	}
+	return true
 }
 
 func (f *Filter) Out() []string {
 	return f.q
 }
 
+// Returns the episodes that passed the filtering, in the same order as Out().
+func (f *Filter) Episodes() []Episoder {
+	return f.es
+}
+
 func (f *Filter) With(opts ...FilterOpt) {
 	for _, opt := range opts {
 		opt(f)
@@ -150,6 +200,7 @@ func (f *Filter) With(opts ...FilterOpt) {
 func NewFilter(opts ...FilterOpt) *Filter {
 	f := &Filter{
 		q:     []string{},
+		es:    []Episoder{},
 		chain: []FilterFn{},
 	}
 	f.With(opts...)
@@ -160,12 +211,53 @@ func NewFilter(opts ...FilterOpt) *Filter {
 // Filters out an episode if it was updated before the given date.
 func FilterUpdatedAfter(dt time.Time) FilterOpt {
 	fn := func(e Episoder) bool {
-		tm, ok := e.JstUpdatedAt()
+		tm, ok := updatedAt(e)
+		return ok && !tm.Before(dt)
+	}
+
+	return func(f *Filter) {
+		f.chain = append(f.chain, fn)
+	}
+}
+
+// Filters out an episode if it was updated on or after the given date.
+func FilterUpdatedBefore(dt time.Time) FilterOpt {
+	fn := func(e Episoder) bool {
+		tm, ok := updatedAt(e)
+		return ok && tm.Before(dt)
+	}
+
+	return func(f *Filter) {
+		f.chain = append(f.chain, fn)
+	}
+}
+
+// Filters out an episode if it was not updated on the same JST date as the given time.
+func FilterUpdatedOn(dt time.Time) FilterOpt {
+	day := onsen.JstDate(dt)
+	fn := func(e Episoder) bool {
+		tm, ok := updatedAt(e)
+		return ok && onsen.JstDate(tm).Equal(day)
+	}
+
+	return func(f *Filter) {
+		f.chain = append(f.chain, fn)
+	}
+}
+
+// Filters out an episode if its radio is not delivered on any of the weekdays, see onsen.Radio.Schedule().
+func FilterWeekday(o *onsen.Onsen, days ...time.Weekday) FilterOpt {
+	fn := func(e Episoder) bool {
+		r, ok := o.Radio(e.RadioId())
 		if !ok {
-			log.Printf("%d: doesn't have update time, filtered\n", e.Id())
 			return false
 		}
-		return !tm.Before(dt)
+		for _, d := range days {
+			if r.IsDeliveredOn(d) {
+				return true
+			}
+		}
+		return false
 	}
 
 	return func(f *Filter) {
@@ -173,13 +265,81 @@ func FilterUpdatedAfter(dt time.Time) FilterOpt {
 	}
 }
 
+func updatedAt(e Episoder) (time.Time, bool) {
+	tm, ok := e.JstUpdatedAt()
+	if !ok {
+		log.Printf("%d: doesn't have update time, filtered\n", e.Id())
+	}
+	return tm, ok
+}
+
+// The filtering flags shared by the commands taking episodes, i.e. ls, lsm, get, sync and featuring.
+type filterFlags struct {
+	after    JstHyphenDate
+	before   JstHyphenDate
+	on       JstHyphenDate
+	since    JstRelativeDate
+	weekdays []string
+	where    string
+}
+
+func (ff *filterFlags) bind(cmd *cobra.Command) {
+	fs := cmd.Flags()
+	fs.Var(&ff.after, "after", "show only those that are on or after this date (in JST)")
+	fs.Var(&ff.before, "before", "show only those that are before this date (in JST)")
+	fs.Var(&ff.on, "on", "show only those that are on this date (in JST)")
+	fs.Var(&ff.since, "since", "show only those that are on or after this date, or 7d, 2w, yesterday, last-friday")
+	fs.StringSliceVar(&ff.weekdays, "weekday", nil, "show only those of the radio shows delivered on these weekdays, e.g.: fri,sat")
+	fs.StringVar(&ff.where, "where", "", "show only those matching this expression, e.g.: 'video and guest~日高'")
+}
+
+// Whether any of the flags is set.
+func (ff *filterFlags) isSet() bool {
+	return ff.after != (JstHyphenDate{}) || ff.before != (JstHyphenDate{}) || ff.on != (JstHyphenDate{}) ||
+		ff.since != (JstRelativeDate{}) || len(ff.weekdays) > 0 || ff.where != ""
+}
+
+// Creates a Filter according to the flags, o is to look up the radios of episodes.
+func (ff *filterFlags) build(o *onsen.Onsen) (*Filter, error) {
+	f := NewFilter()
+	if ff.after != (JstHyphenDate{}) {
+		f.With(FilterUpdatedAfter(time.Time(ff.after)))
+	}
+	if ff.before != (JstHyphenDate{}) {
+		f.With(FilterUpdatedBefore(time.Time(ff.before)))
+	}
+	if ff.on != (JstHyphenDate{}) {
+		f.With(FilterUpdatedOn(time.Time(ff.on)))
+	}
+	if ff.since != (JstRelativeDate{}) {
+		f.With(FilterUpdatedAfter(time.Time(ff.since)))
+	}
+	if len(ff.weekdays) > 0 {
+		days := make([]time.Weekday, len(ff.weekdays))
+		for i, s := range ff.weekdays {
+			d, err := onsen.ParseWeekday(s)
+			if err != nil {
+				return nil, fmt.Errorf("--weekday: unknown weekday %q", s)
+			}
+			days[i] = d
+		}
+		f.With(FilterWeekday(o, days...))
+	}
+	if ff.where != "" {
+		opt, err := FilterWhere(ff.where)
+		if err != nil {
+			return nil, fmt.Errorf("--where: %w", err)
+		}
+		f.With(opt)
+	}
+	return f, nil
+}
+
 // A custom date format to fulfill pflag.Value interface.
 type JstHyphenDate time.Time
 
 func (h *JstHyphenDate) Set(dt string) error {
-	loc := time.FixedZone("UTC+9", 9*60*60)
-
-	tm, err := time.ParseInLocation("2006-01-02", dt, loc)
+	tm, err := onsen.ParseJstDate(dt)
 	if err != nil {
 		return err
 	}
@@ -196,3 +356,25 @@ func (h *JstHyphenDate) Type() string {
 func (h *JstHyphenDate) String() string {
 	return ""
 }
+
+// A date relative to now, see onsen.ParseJstRelativeDate(). It fulfills pflag.Value interface.
+type JstRelativeDate time.Time
+
+func (r *JstRelativeDate) Set(s string) error {
+	tm, err := onsen.ParseJstRelativeDateWithNow(s)
+	if err != nil {
+		return err
+	}
+
+	*r = JstRelativeDate(tm)
+
+	return nil
+}
+
+func (r *JstRelativeDate) Type() string {
+	return "DATE"
+}
+
+func (r *JstRelativeDate) String() string {
+	return ""
+}
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/adios/onsengo/onsen"
+	pp "github.com/adios/pprint"
+)
+
+var me = struct {
+	unheard bool
+
+	cmd *cobra.Command
+}{
+	cmd: &cobra.Command{
+		Use:   "me",
+		Short: "Show the account status of the session",
+		Long: `
+Show the account status of the signed-in user: the premium plan, following
+radio shows and people, and the listen history.
+
+Use --unheard to list the episodes of following radio shows which are not
+marked watched, in the same table as ls -r. The position to resume from takes
+the place of the episode count, - if it has not been started.
+`,
+	},
+}
+
+func init() {
+	root.cmd.AddCommand(me.cmd)
+
+	me.cmd.RunE = runMe
+	me.cmd.Flags().BoolVar(&me.unheard, "unheard", false, "list episodes of following radio shows not watched")
+}
+
+func runMe(cmd *cobra.Command, args []string) error {
+	o, err := root.onsen()
+	if err != nil {
+		return err
+	}
+
+	u, ok := o.User()
+	if !ok {
+		return fmt.Errorf("me: no user signed in")
+	}
+
+	lib, err := root.library()
+	if err != nil {
+		return err
+	}
+
+	t, err := root.template()
+	if err != nil {
+		return err
+	}
+
+	if me.unheard {
+		return unheard(o, t, newLettering(lib))
+	}
+
+	switch {
+	case t != nil:
+		return writeTemplate(root.outw(), t, []interface{}{u})
+	case root.output == outputJSON, root.output == outputNDJSON:
+		// A single object rather than an array of one
+		enc := json.NewEncoder(root.outw())
+		if root.output == outputJSON {
+			enc.SetIndent("", "  ")
+		}
+		return enc.Encode(newUserModel(o, u))
+	case root.output != outputTable:
+		return fmt.Errorf("me: --output %s is not supported, use json or ndjson", root.output)
+	}
+
+	var (
+		hs      = o.History()
+		watched int
+	)
+	for _, l := range hs {
+		if l.IsWatched() {
+			watched++
+		}
+	}
+
+	premium := "-"
+	if u.IsPremium() {
+		premium = u.Premium()
+		if tm, ok := u.JstSubscriptionEndsAt(); ok {
+			premium += ", until " + tm.Format("2006-01-02")
+		}
+	}
+
+	social := "-"
+	if names := u.SocialAccounts(); len(names) != 0 {
+		social = strings.Join(names, ", ")
+	}
+
+	w := root.outw()
+	fmt.Fprintf(w, "email:     %s\n", u.Email())
+	fmt.Fprintf(w, "uid:       %s\n", u.Uid())
+	fmt.Fprintf(w, "premium:   %s\n", premium)
+	fmt.Fprintf(w, "social:    %s\n", social)
+	fmt.Fprintf(w, "following: %d radio(s), %d people\n", len(u.FollowingRadios()), len(u.FollowingPeople()))
+	fmt.Fprintf(w, "playlist:  %d episode(s)\n", len(u.PlaylistEpisodes()))
+	fmt.Fprintf(w, "history:   %d episode(s), %d watched\n", len(hs), watched)
+	return nil
+}
+
+// Lists the unheard episodes in ascending order on uploaded/published date.
+func unheard(o *onsen.Onsen, t *template.Template, l lettering) error {
+	es := o.Unheard()
+	sort.SliceStable(es, func(i, j int) bool {
+		a, _ := es[i].JstUpdatedAt()
+		b, _ := es[j].JstUpdatedAt()
+		return a.Before(b)
+	})
+
+	switch {
+	case t != nil:
+		items := make([]interface{}, len(es))
+		for i, e := range es {
+			items[i] = newEpisodeData(o, e)
+		}
+		return writeTemplate(root.outw(), t, items)
+	case root.output != outputTable:
+		models := make([]episodeModel, len(es))
+		for i, e := range es {
+			models[i] = newEpisodeModel(e, radioName(o, e))
+		}
+		return writeEpisodeModels(root.outw(), root.output, models)
+	}
+
+	positions := make(map[int]time.Duration)
+	for _, h := range o.History() {
+		positions[h.Episode.Id()] = h.Position()
+	}
+
+	out := typeset()
+	for _, e := range es {
+		tm, _ := e.JstUpdatedAt()
+		out.Push(
+			l.episode(e),
+			formatPosition(positions[e.Id()]),
+			mtime(tm),
+			radioName(o, e)+"/"+strconv.Itoa(e.Id()),
+			e.Title(),
+		)
+	}
+	pp.Print(out, pp.WithWriter(root.outw()))
+
+	return nil
+}
+
+// Formats a position in m:ss, or h:mm:ss if it is longer than an hour, - if zero.
+func formatPosition(d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+
+	s := int(d.Seconds())
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
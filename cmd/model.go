@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/adios/onsengo/onsen"
+)
+
+// JSON representations of the onsen types, they are the schema of machine-readable outputs.
+
+type radioModel struct {
+	Id        int            `json:"id"`
+	Name      string         `json:"name"`
+	Title     string         `json:"title"`
+	Image     string         `json:"image,omitempty"`
+	UpdatedAt *time.Time     `json:"updated_at,omitempty"`
+	New       bool           `json:"new"`
+	Hosts     []personModel  `json:"hosts"`
+	Count     int            `json:"episode_count"`
+	Episodes  []episodeModel `json:"episodes,omitempty"`
+}
+
+type episodeModel struct {
+	Id        int           `json:"id"`
+	RadioId   int           `json:"radio_id"`
+	Radio     string        `json:"radio"`
+	Title     string        `json:"title"`
+	UpdatedAt *time.Time    `json:"updated_at,omitempty"`
+	Manifest  string        `json:"manifest,omitempty"`
+	Poster    string        `json:"poster,omitempty"`
+	Guests    []personModel `json:"guests"`
+	Bonus     bool          `json:"bonus"`
+	Sticky    bool          `json:"sticky"`
+	Latest    bool          `json:"latest"`
+	Premium   bool          `json:"premium"`
+	Video     bool          `json:"video"`
+	MediaType string        `json:"media_type"`
+	Expiring  bool          `json:"expiring"`
+	OngenId   int           `json:"ongen_id"`
+	TagImage  string        `json:"tag_image,omitempty"`
+}
+
+type personModel struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type personDetailModel struct {
+	personModel
+	Radios   []radioModel   `json:"radios"`
+	Episodes []episodeModel `json:"episodes"`
+}
+
+type userModel struct {
+	Email              string          `json:"email"`
+	Uid                string          `json:"uid"`
+	Premium            string          `json:"premium,omitempty"`
+	SubscriptionEndsAt *time.Time      `json:"subscription_ends_at,omitempty"`
+	SocialAccounts     []string        `json:"social_accounts"`
+	FollowingPeople    []int           `json:"following_people"`
+	FollowingRadios    []int           `json:"following_radios"`
+	PlaylistEpisodes   []int           `json:"playlist_episodes"`
+	History            []listenedModel `json:"history"`
+}
+
+type listenedModel struct {
+	EpisodeId int    `json:"episode_id"`
+	Radio     string `json:"radio"`
+	Watched   bool   `json:"watched"`
+	// In seconds
+	Position int `json:"position"`
+}
+
+// Episodes are included only if withEpisodes is set.
+func newRadioModel(r onsen.Radio, withEpisodes bool) radioModel {
+	es := r.Episodes()
+	m := radioModel{
+		Id:    r.Id(),
+		Name:  r.Name(),
+		Title: r.Title(),
+		Image: r.Image(),
+		New:   r.HasBeenUpdated(),
+		Hosts: newPersonModels(r.Hosts()),
+		Count: len(es),
+	}
+	if tm, ok := r.JstUpdatedAt(); ok {
+		m.UpdatedAt = &tm
+	}
+	if withEpisodes {
+		m.Episodes = make([]episodeModel, len(es))
+		for i, e := range es {
+			m.Episodes[i] = newEpisodeModel(e, r.Name())
+		}
+	}
+	return m
+}
+
+// radio is the name of the radio which the episode belongs to.
+func newEpisodeModel(e onsen.Episode, radio string) episodeModel {
+	u, _ := e.Manifest()
+	m := episodeModel{
+		Id:        e.Id(),
+		RadioId:   e.RadioId(),
+		Radio:     radio,
+		Title:     e.Title(),
+		Manifest:  u,
+		Poster:    e.Poster(),
+		Guests:    newPersonModels(e.Guests()),
+		Bonus:     e.IsBonus(),
+		Sticky:    e.IsSticky(),
+		Latest:    e.IsLatest(),
+		Premium:   e.RequiresPremium(),
+		Video:     e.HasVideoStream(),
+		MediaType: e.MediaType(),
+		Expiring:  e.IsExpiring(),
+		OngenId:   e.OngenId(),
+		TagImage:  e.TagImage(),
+	}
+	if tm, ok := e.JstUpdatedAt(); ok {
+		m.UpdatedAt = &tm
+	}
+	return m
+}
+
+func newPersonModels(ps []onsen.Person) []personModel {
+	out := make([]personModel, len(ps))
+	for i, p := range ps {
+		out[i] = personModel{Id: p.Id(), Name: p.Name()}
+	}
+	return out
+}
+
+func newPersonDetailModel(o *onsen.Onsen, a onsen.Appearances) personDetailModel {
+	m := personDetailModel{
+		personModel: personModel{Id: a.Id(), Name: a.Name()},
+		Radios:      make([]radioModel, len(a.Hosted)),
+		Episodes:    make([]episodeModel, len(a.Guested)),
+	}
+	for i, r := range a.Hosted {
+		m.Radios[i] = newRadioModel(r, false)
+	}
+	for i, e := range a.Guested {
+		m.Episodes[i] = newEpisodeModel(e, radioName(o, e))
+	}
+	return m
+}
+
+// The history is joined to the episodes of o.
+func newUserModel(o *onsen.Onsen, u onsen.User) userModel {
+	m := userModel{
+		Email:            u.Email(),
+		Uid:              u.Uid(),
+		Premium:          u.Premium(),
+		SocialAccounts:   u.SocialAccounts(),
+		FollowingPeople:  u.FollowingPeople(),
+		FollowingRadios:  u.FollowingRadios(),
+		PlaylistEpisodes: u.PlaylistEpisodes(),
+		History:          []listenedModel{},
+	}
+	if tm, ok := u.JstSubscriptionEndsAt(); ok {
+		m.SubscriptionEndsAt = &tm
+	}
+	for _, l := range o.History() {
+		m.History = append(m.History, listenedModel{
+			EpisodeId: l.Episode.Id(),
+			Radio:     radioName(o, l.Episode),
+			Watched:   l.IsWatched(),
+			Position:  int(l.Position().Seconds()),
+		})
+	}
+	return m
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/adios/onsengo/notify"
+	"github.com/adios/onsengo/onsen"
+)
+
+var notif = struct {
+	rules  string
+	dryRun bool
+	cmd    *cobra.Command
+}{
+	cmd: &cobra.Command{
+		Use:   "notify",
+		Short: "Notify new episodes to webhooks, Discord, Slack or email",
+		Long: `
+Compare the website to the latest snapshot, send notifications of the new
+episodes by the rules, and save the website as the next snapshot. The first
+run saves a snapshot only. Run it periodically, e.g. by cron:
+
+  */30 * * * * onsengo notify --rules ~/.config/onsengo/rules.json -s SESSION
+
+The rules file is in JSON, notifiers are named and referred to by the rules:
+
+  {
+    "notifiers": {
+      "team": {"type": "discord", "url": "https://discord.com/api/webhooks/..."},
+      "me":   {"type": "smtp", "addr": "smtp.example.com:587",
+               "from": "onsengo@example.com", "to": ["me@example.com"],
+               "username": "me", "password": "..."}
+    },
+    "rules": [
+      {"radios": ["fujita", "gurepap"], "notify": ["team"]},
+      {"people": ["日高里菜"], "following": true, "notify": ["me"],
+       "subject": "{{.Radio.Title}} {{.Episode.Title}}",
+       "body": "{{join \", \" .Episode.Guests}}"}
+    ]
+  }
+
+Types of notifiers are webhook, discord, slack and smtp. An episode matches a
+rule by the names or ids of its radio, the hosts and guests in people, or its
+radio is followed by the user with "following". Subjects and bodies are Go
+templates of .Radio and .Episode.
+`,
+		Args: cobra.NoArgs,
+	},
+}
+
+func init() {
+	root.cmd.AddCommand(notif.cmd)
+
+	f := notif.cmd.Flags()
+	f.StringVar(&notif.rules, "rules", "", "set the rules file")
+	f.StringVar(&snap.store, "store", "", "set snapshot directory")
+	f.BoolVarP(&notif.dryRun, "dry-run", "n", false, "print the notifications instead of sending them, and save no snapshot")
+	notif.cmd.MarkFlagRequired("rules")
+
+	notif.cmd.RunE = runNotify
+}
+
+func runNotify(cmd *cobra.Command, args []string) error {
+	r, err := notify.Load(notif.rules, root.client())
+	if err != nil {
+		return err
+	}
+
+	s, err := openStore()
+	if err != nil {
+		return err
+	}
+
+	raw, o, err := root.fetchRaw()
+	if err != nil {
+		return err
+	}
+
+	sn, ok, err := s.Latest()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if notif.dryRun {
+			return fmt.Errorf("notify: no snapshot in %s to compare to", s.Dir())
+		}
+		sn, err := s.Save(raw, time.Now())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(root.errw(), "notify: no snapshot to compare to, saved %s\n", sn.Path)
+		return nil
+	}
+
+	prev, err := sn.Load()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, c := range onsen.Diff(prev, o) {
+		if c.Kind != onsen.EpisodeAdded {
+			continue
+		}
+
+		ms, err := r.Messages(o, c.Episode)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, m := range ms {
+			if notif.dryRun {
+				fmt.Fprintf(root.outw(), "%s/%d -> %s: %s\n", c.Radio.Name(), c.Episode.Id(), m.To, m.Subject)
+				continue
+			}
+			if err := r.Send(m); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			fmt.Fprintf(root.outw(), "%s/%d -> %s\n", c.Radio.Name(), c.Episode.Id(), m.To)
+		}
+	}
+
+	if !notif.dryRun {
+		// Failed notifications are not retried, to not notify the others twice.
+		if _, err := s.Save(raw, time.Now()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The --output format, it fulfills pflag.Value interface and rejects unknown formats.
+type outputFormat string
+
+const (
+	outputTable  outputFormat = "table"
+	outputJSON   outputFormat = "json"
+	outputNDJSON outputFormat = "ndjson"
+	outputCSV    outputFormat = "csv"
+	outputTSV    outputFormat = "tsv"
+)
+
+func (f *outputFormat) Set(s string) error {
+	switch v := outputFormat(s); v {
+	case outputTable, outputJSON, outputNDJSON, outputCSV, outputTSV:
+		*f = v
+		return nil
+	}
+	return fmt.Errorf("unknown format %q, must be one of json, ndjson, csv, tsv and table", s)
+}
+
+func (f *outputFormat) Type() string {
+	return "FORMAT"
+}
+
+func (f *outputFormat) String() string {
+	return string(*f)
+}
+
+// Writes the models in a structured format: json writes them in an array, ndjson writes one per line, csv and tsv
+// write the header followed by the rows.
+func writeModels(w io.Writer, format outputFormat, models []interface{}, header []string, rows [][]string) error {
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(models)
+	case outputNDJSON:
+		enc := json.NewEncoder(w)
+		for _, m := range models {
+			if err := enc.Encode(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	case outputCSV, outputTSV:
+		cw := csv.NewWriter(w)
+		if format == outputTSV {
+			cw.Comma = '\t'
+		}
+		cw.Write(header)
+		cw.WriteAll(rows)
+		return cw.Error()
+	}
+	return fmt.Errorf("writeModels: unsupported format %q", format)
+}
+
+var (
+	radioHeader   = []string{"id", "name", "title", "hosts", "updated_at", "new", "episode_count"}
+	episodeHeader = []string{
+		"radio_id", "radio", "id", "title", "updated_at", "guests", "manifest",
+		"bonus", "sticky", "latest", "premium", "video", "media_type", "expiring", "ongen_id",
+	}
+	personHeader = []string{"id", "name", "radios", "episodes"}
+)
+
+func (m radioModel) row() []string {
+	return []string{
+		strconv.Itoa(m.Id),
+		m.Name,
+		m.Title,
+		joinNames(m.Hosts),
+		formatTime(m.UpdatedAt),
+		strconv.FormatBool(m.New),
+		strconv.Itoa(m.Count),
+	}
+}
+
+func (m episodeModel) row() []string {
+	return []string{
+		strconv.Itoa(m.RadioId),
+		m.Radio,
+		strconv.Itoa(m.Id),
+		m.Title,
+		formatTime(m.UpdatedAt),
+		joinNames(m.Guests),
+		m.Manifest,
+		strconv.FormatBool(m.Bonus),
+		strconv.FormatBool(m.Sticky),
+		strconv.FormatBool(m.Latest),
+		strconv.FormatBool(m.Premium),
+		strconv.FormatBool(m.Video),
+		m.MediaType,
+		strconv.FormatBool(m.Expiring),
+		strconv.Itoa(m.OngenId),
+	}
+}
+
+// The radios hosted by names, and the episodes guested by name/id, both separated by ";".
+func (m personDetailModel) row() []string {
+	var (
+		rs = make([]string, len(m.Radios))
+		es = make([]string, len(m.Episodes))
+	)
+	for i, r := range m.Radios {
+		rs[i] = r.Name
+	}
+	for i, e := range m.Episodes {
+		es[i] = e.Radio + "/" + strconv.Itoa(e.Id)
+	}
+	return []string{strconv.Itoa(m.Id), m.Name, strings.Join(rs, ";"), strings.Join(es, ";")}
+}
+
+// Writes radios, or their episodes in csv and tsv if withEpisodes is set.
+func writeRadioModels(w io.Writer, format outputFormat, rs []radioModel, withEpisodes bool) error {
+	var (
+		models = make([]interface{}, len(rs))
+		rows   [][]string
+	)
+	for i, r := range rs {
+		models[i] = r
+		if !withEpisodes {
+			rows = append(rows, r.row())
+			continue
+		}
+		for _, e := range r.Episodes {
+			rows = append(rows, e.row())
+		}
+	}
+
+	header := radioHeader
+	if withEpisodes {
+		header = episodeHeader
+	}
+	return writeModels(w, format, models, header, rows)
+}
+
+func writeEpisodeModels(w io.Writer, format outputFormat, es []episodeModel) error {
+	var (
+		models = make([]interface{}, len(es))
+		rows   = make([][]string, len(es))
+	)
+	for i, e := range es {
+		models[i], rows[i] = e, e.row()
+	}
+	return writeModels(w, format, models, episodeHeader, rows)
+}
+
+func joinNames(ps []personModel) string {
+	names := make([]string, len(ps))
+	for i, p := range ps {
+		names[i] = p.Name
+	}
+	return strings.Join(names, ";")
+}
+
+func formatTime(tm *time.Time) string {
+	if tm == nil {
+		return ""
+	}
+	return tm.Format(time.RFC3339)
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/adios/onsengo/onsen"
+	pp "github.com/adios/pprint"
+)
+
+var people = struct {
+	cmd *cobra.Command
+}{
+	cmd: &cobra.Command{
+		Use:   "people [name...]",
+		Short: "List performers and their appearances",
+		Long: `
+List performers in ascending order on their latest appearance, with the count
+of radio shows hosted plus episodes guested. Provide names or ids to list the
+radio shows they host and the episodes they guest in, in the same table as ls.
+`,
+	},
+}
+
+func init() {
+	root.cmd.AddCommand(people.cmd)
+
+	people.cmd.RunE = runPeople
+}
+
+func runPeople(cmd *cobra.Command, args []string) error {
+	o, err := root.onsen()
+	if err != nil {
+		return err
+	}
+
+	lib, err := root.library()
+	if err != nil {
+		return err
+	}
+
+	t, err := root.template()
+	if err != nil {
+		return err
+	}
+
+	var as []onsen.Appearances
+	switch len(args) {
+	case 0:
+		for k, a := range o.PersonIndex() {
+			// Every person is indexed by its id and its name
+			if _, ok := k.(int); ok {
+				as = append(as, a)
+			}
+		}
+		sort.Slice(as, func(i, j int) bool { return as[i].Id() < as[j].Id() })
+	default:
+		for _, arg := range unique(args) {
+			a, ok := findPerson(o, arg)
+			if !ok {
+				fmt.Fprintf(root.errw(), "%s: not found\n", arg)
+				continue
+			}
+			as = append(as, a)
+		}
+	}
+
+	switch {
+	case t != nil:
+		items := make([]interface{}, len(as))
+		for i, a := range as {
+			items[i] = newPersonData(o, a)
+		}
+		return writeTemplate(root.outw(), t, items)
+	case root.output != outputTable:
+		var (
+			models = make([]interface{}, len(as))
+			rows   = make([][]string, len(as))
+		)
+		for i, a := range as {
+			m := newPersonDetailModel(o, a)
+			models[i], rows[i] = m, m.row()
+		}
+		return writeModels(root.outw(), root.output, models, personHeader, rows)
+	}
+
+	var (
+		out = typeset()
+		l   = newLettering(lib)
+	)
+	for _, a := range as {
+		dir := addPerson(out, a)
+		if len(args) == 0 {
+			continue
+		}
+		for _, r := range a.Hosted {
+			addRadio(dir, l, r, len(r.Episodes()))
+		}
+		for _, e := range a.Guested {
+			addEpisode(dir, l, radioName(o, e), e)
+		}
+	}
+
+	// 0, 1, 2: letters, count, mtime ...
+	if err := out.Sort(2, pp.WithCmpMatchers(mtimeCmp)); err != nil {
+		return err
+	}
+
+	pp.Print(out, pp.WithWriter(root.outw()))
+
+	return nil
+}
+
+// Looks up a person by the name, or the id if it is a number.
+func findPerson(o *onsen.Onsen, arg string) (onsen.Appearances, bool) {
+	if a, ok := o.Person(arg); ok {
+		return a, true
+	}
+	if id, err := strconv.Atoi(arg); err == nil {
+		return o.Person(id)
+	}
+	return onsen.Appearances{}, false
+}
+
+// The ls letters of a person, as a directory of radios and episodes.
+const personLetters = "d--------"
+
+// Returns the pushed node to further push the radios and the episodes of the person. The mtime is of the latest
+// appearance.
+func addPerson(out *pp.Node, a onsen.Appearances) (pushed *pp.Node) {
+	var latest time.Time
+	for _, r := range a.Hosted {
+		if tm, ok := r.JstUpdatedAt(); ok && tm.After(latest) {
+			latest = tm
+		}
+	}
+	for _, e := range a.Guested {
+		if tm, ok := e.JstUpdatedAt(); ok && tm.After(latest) {
+			latest = tm
+		}
+	}
+
+	pushed, _ = out.Push(
+		personLetters,
+		len(a.Hosted)+len(a.Guested),
+		mtime(latest),
+		a.Name(),
+		fmt.Sprintf("%d radio(s), %d guest appearance(s)", len(a.Hosted), len(a.Guested)),
+	)
+
+	return pushed
+}
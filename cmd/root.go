@@ -2,12 +2,18 @@
 package cmd
 
 import (
+	"bufio"
+	"errors"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 
+	"github.com/adios/onsengo/archive"
+	"github.com/adios/onsengo/cookies"
 	"github.com/adios/onsengo/onsen"
 )
 
@@ -23,15 +29,46 @@ onsengo♨ is a program which allows browsing radio shows on https://onsen.ag.
 	},
 }
 
+// Exit codes of errors, see ExitCode().
+const (
+	ExitFailure        = 1
+	ExitSessionExpired = 3
+)
+
 func Execute() error {
 	return root.cmd.Execute()
 }
 
+// Returns the exit code of an error of Execute(), so scripts can tell an expired session from other failures.
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, onsen.ErrSessionExpired):
+		return ExitSessionExpired
+	default:
+		return ExitFailure
+	}
+}
+
 func init() {
 	pf := root.cmd.PersistentFlags()
 
 	pf.StringVar(&root.backend, "backend", "https://onsen.ag/", "set backend, file:// is supported")
 	pf.StringVarP(&root.session, "session", "s", "", "set session")
+	pf.StringVar(&root.archive, "archive", "", "set archive directory to record and look up downloaded episodes")
+	root.output = outputTable
+	pf.VarP(&root.output, "output", "o", "set output format of listings: table, json, ndjson, csv or tsv")
+	pf.StringVar(&root.format, "format", "", "format each item of listings with a Go template, overrides --output")
+	pf.StringVar(&root.configFile, "config", "", "set config file, see the config command")
+	pf.StringVar(&root.cookies, "cookies", "", "load cookies from a Netscape cookies.txt or a JSON export")
+
+	root.cmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if err := root.applyConfig(cmd); err != nil {
+			return err
+		}
+		return root.loadCookies()
+	}
 }
 
 type ctx struct {
@@ -39,7 +76,17 @@ type ctx struct {
 	backend string
 	// You can find the id from "_session_id=SESSION_ID" in the browser's cookie.
 	session string
-	cmd     *cobra.Command
+	// Cookies exported from the browser, see package cookies. The session in them takes precedence.
+	cookies string
+	// Directory of downloaded episodes, see package archive.
+	archive string
+	// Output format of listing commands
+	output outputFormat
+	// Go template of listing commands, e.g.: {{.Radio.Name}}/{{.Id}} {{.Date}}
+	format string
+	// Defaults of the options, see the config command.
+	configFile string
+	cmd        *cobra.Command
 
 	// for testing onsen/pprint/fprintf output
 	out io.Writer
@@ -48,6 +95,16 @@ type ctx struct {
 	// for onsen
 	hc *http.Client
 	oo *onsen.Onsen
+
+	// for archive
+	lib *archive.Library
+
+	// for config
+	conf *config
+
+	// for login, whether the session file has been read
+	sessionRead bool
+	in          *bufio.Reader
 }
 
 func (c *ctx) client() *http.Client {
@@ -60,15 +117,82 @@ func (c *ctx) client() *http.Client {
 	return c.hc
 }
 
+// Sets the cookies of --cookies in the jar of the client, or no jar without them.
+func (c *ctx) loadCookies() error {
+	if c.cookies == "" {
+		c.client().Jar = nil
+		return nil
+	}
+
+	cs, err := cookies.Load(c.cookies)
+	if err != nil {
+		return err
+	}
+	jar, err := cookies.NewJar(cs)
+	if err != nil {
+		return err
+	}
+	c.client().Jar = jar
+	return nil
+}
+
+// Returns the cookie in the jar for the url.
+func (c *ctx) cookie(u *url.URL, name string) (ck *http.Cookie, ok bool) {
+	if c.client().Jar == nil {
+		return nil, false
+	}
+	for _, ck := range c.client().Jar.Cookies(u) {
+		if ck.Name == name {
+			return ck, true
+		}
+	}
+	return nil, false
+}
+
+// Returns the session in --cookies for the backend.
+func (c *ctx) cookieSession() (string, bool) {
+	u, err := url.Parse(c.backend)
+	if err != nil {
+		return "", false
+	}
+	ck, ok := c.cookie(u, "_session_id")
+	if !ok {
+		return "", false
+	}
+	return ck.Value, true
+}
+
+// Whether a session is given for the backend, by --cookies or as sessionId().
+func (c *ctx) hasSession() (bool, error) {
+	if _, ok := c.cookieSession(); ok {
+		return true, nil
+	}
+	sid, err := c.sessionId()
+	return sid != "", err
+}
+
 func (c *ctx) request() (*http.Response, error) {
-	req, err := http.NewRequest("GET", c.backend, nil)
+	return c.get(c.backend)
+}
+
+// Requests the url with the same client and User-Agent as the backend. Downloads of playlists and segments go through
+// here. The session is sent to the host of the backend only, other hosts get the cookies of their domains in the jar.
+func (c *ctx) get(url string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Add("User-Agent", ua)
-	if c.session != "" {
-		req.Header.Add("Cookie", "_session_id="+c.session)
+	// The jar adds the cookies of --cookies, of which the session takes precedence
+	if _, ok := c.cookie(req.URL, "_session_id"); !ok && c.isBackend(req.URL) {
+		sid, err := c.sessionId()
+		if err != nil {
+			return nil, err
+		}
+		if sid != "" {
+			req.Header.Add("Cookie", "_session_id="+sid)
+		}
 	}
 
 	resp, err := c.client().Do(req)
@@ -78,6 +202,12 @@ func (c *ctx) request() (*http.Response, error) {
 	return resp, nil
 }
 
+// Whether the url is on the host of the backend, to which the session belongs.
+func (c *ctx) isBackend(u *url.URL) bool {
+	b, err := url.Parse(c.backend)
+	return err == nil && strings.EqualFold(u.Scheme, b.Scheme) && strings.EqualFold(u.Host, b.Host)
+}
+
 func (c *ctx) html() (string, error) {
 	resp, err := c.request()
 	if err != nil {
@@ -94,17 +224,61 @@ func (c *ctx) html() (string, error) {
 
 func (c *ctx) onsen() (*onsen.Onsen, error) {
 	if c.oo == nil {
-		html, err := c.html()
+		o, err := c.fetch()
 		if err != nil {
 			return nil, err
 		}
-		o, err := onsen.Create(html)
+		c.oo = o
+	}
+	return c.oo, nil
+}
+
+// Requests the backend for a new Onsen every time, for long-running commands to refresh the data. It fails with
+// onsen.ErrSessionExpired if a session is given but not signed in.
+func (c *ctx) fetch() (*onsen.Onsen, error) {
+	_, o, err := c.fetchRaw()
+	return o, err
+}
+
+// Same as fetch(), along with the raw data of the Onsen for snapshots.
+func (c *ctx) fetchRaw() (string, *onsen.Onsen, error) {
+	html, err := c.html()
+	if err != nil {
+		return "", nil, err
+	}
+	raw, err := onsen.RawData(html)
+	if err != nil {
+		return "", nil, err
+	}
+	o, err := onsen.CreateFromRawData(raw)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Archived pages of file:// are as they were saved, whatever the session
+	if u, err := url.Parse(c.backend); err == nil && u.Scheme == "file" {
+		return raw, o, nil
+	}
+	ok, err := c.hasSession()
+	if err != nil {
+		return "", nil, err
+	}
+	if _, signed := o.User(); ok && !signed {
+		return "", nil, onsen.ErrSessionExpired
+	}
+	return raw, o, nil
+}
+
+// Returns nil if no archive is set.
+func (c *ctx) library() (*archive.Library, error) {
+	if c.lib == nil && c.archive != "" {
+		l, err := archive.Open(c.archive)
 		if err != nil {
 			return nil, err
 		}
-		c.oo = o
+		c.lib = l
 	}
-	return c.oo, nil
+	return c.lib, nil
 }
 
 func (c *ctx) outw() io.Writer {
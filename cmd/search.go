@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/adios/onsengo/onsen"
+	pp "github.com/adios/pprint"
+)
+
+var search = struct {
+	limit int
+
+	cmd *cobra.Command
+}{
+	cmd: &cobra.Command{
+		Use:   "search query...",
+		Short: "Search radio shows, episodes and people",
+		Long: `
+Search radio shows by names, titles and hosts, episodes by titles and guests,
+and people by names. Results match every word of the query and go in
+descending order on relevance, in the same table as ls and people.
+
+Full-width and half-width letters are not distinguished, neither are hiragana
+and katakana:
+
+  onsengo search 藤田
+  onsengo search ぐれぱら
+  onsengo search fujita 予告
+`,
+	},
+}
+
+func init() {
+	root.cmd.AddCommand(search.cmd)
+
+	search.cmd.RunE = runSearch
+	search.cmd.Args = cobra.MinimumNArgs(1)
+	search.cmd.Flags().IntVarP(&search.limit, "limit", "n", 20, "show at most this many results, 0 for all")
+}
+
+type searchModel struct {
+	Kind    string        `json:"kind"`
+	Score   int           `json:"score"`
+	Radio   *radioModel   `json:"radio,omitempty"`
+	Episode *episodeModel `json:"episode,omitempty"`
+	Person  *personModel  `json:"person,omitempty"`
+}
+
+func runSearch(cmd *cobra.Command, args []string) error {
+	o, err := root.onsen()
+	if err != nil {
+		return err
+	}
+
+	lib, err := root.library()
+	if err != nil {
+		return err
+	}
+
+	t, err := root.template()
+	if err != nil {
+		return err
+	}
+
+	ms := o.Search(strings.Join(args, " "))
+	if search.limit > 0 && len(ms) > search.limit {
+		ms = ms[:search.limit]
+	}
+
+	switch {
+	case t != nil:
+		items := make([]interface{}, len(ms))
+		for i, m := range ms {
+			items[i] = newMatchData(o, m)
+		}
+		return writeTemplate(root.outw(), t, items)
+	case root.output != outputTable:
+		var (
+			models = make([]interface{}, len(ms))
+			rows   = make([][]string, len(ms))
+		)
+		for i, m := range ms {
+			sm := newSearchModel(m)
+			models[i], rows[i] = sm, sm.row()
+		}
+		return writeModels(root.outw(), root.output, models, searchHeader, rows)
+	}
+
+	var (
+		out = typeset()
+		l   = newLettering(lib)
+	)
+	for _, m := range ms {
+		switch m.Kind {
+		case onsen.KindRadio:
+			addRadio(out, l, m.Radio, len(m.Radio.Episodes()))
+		case onsen.KindEpisode:
+			addEpisode(out, l, m.Radio.Name(), m.Episode)
+		case onsen.KindPerson:
+			a, _ := o.Person(m.Person.Id())
+			addPerson(out, a)
+		}
+	}
+	pp.Print(out, pp.WithWriter(root.outw()))
+
+	return nil
+}
+
+var searchHeader = []string{"kind", "score", "id", "name", "title"}
+
+// The name is of the radio for an episode, and the title is the name for a person.
+func (m searchModel) row() []string {
+	var (
+		id          int
+		name, title string
+	)
+	switch {
+	case m.Radio != nil:
+		id, name, title = m.Radio.Id, m.Radio.Name, m.Radio.Title
+	case m.Episode != nil:
+		id, name, title = m.Episode.Id, m.Episode.Radio, m.Episode.Title
+	case m.Person != nil:
+		id, name, title = m.Person.Id, m.Person.Name, m.Person.Name
+	}
+	return []string{m.Kind, strconv.Itoa(m.Score), strconv.Itoa(id), name, title}
+}
+
+func newSearchModel(m onsen.Match) searchModel {
+	out := searchModel{Kind: m.Kind, Score: m.Score}
+	switch m.Kind {
+	case onsen.KindRadio:
+		r := newRadioModel(m.Radio, false)
+		out.Radio = &r
+	case onsen.KindEpisode:
+		e := newEpisodeModel(m.Episode, m.Radio.Name())
+		out.Episode = &e
+	case onsen.KindPerson:
+		out.Person = &personModel{Id: m.Person.Id(), Name: m.Person.Name()}
+	}
+	return out
+}
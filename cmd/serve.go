@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/adios/onsengo/onsen"
+)
+
+var serve = struct {
+	listen  string
+	refresh time.Duration
+
+	cmd *cobra.Command
+}{
+	cmd: &cobra.Command{
+		Use:   "serve",
+		Short: "Serve radio shows as a JSON API",
+		Long: `
+Serve the radio shows of the backend as a JSON API over HTTP. The data is
+fetched once on start and refreshed periodically, use --refresh 0 to disable
+refreshing.
+
+  GET /radios           all radio shows without episodes
+  GET /radios/{name}    a radio show and its episodes, by name or id
+  GET /episodes/{id}    an episode
+  GET /people/{id}      a person, the radio shows hosted and episodes guested
+  GET /me               the user of the session
+
+  onsengo serve --listen :8080 --refresh 30m -s SESSION
+`,
+	},
+}
+
+func init() {
+	root.cmd.AddCommand(serve.cmd)
+
+	serve.cmd.RunE = runServe
+	serve.cmd.Flags().StringVar(&serve.listen, "listen", "localhost:8080", "listen on this address")
+	serve.cmd.Flags().DurationVar(&serve.refresh, "refresh", time.Hour, "refresh the data in this interval")
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+	a, err := newAPI(root.fetch)
+	if err != nil {
+		return err
+	}
+
+	if serve.refresh > 0 {
+		go func() {
+			for range time.Tick(serve.refresh) {
+				if err := a.refresh(); err != nil {
+					fmt.Fprintf(root.errw(), "refresh: %s\n", err)
+				}
+			}
+		}()
+	}
+
+	fmt.Fprintf(root.errw(), "listening on %s\n", serve.listen)
+	return http.ListenAndServe(serve.listen, a)
+}
+
+// Serves an Onsen which is replaced on every refresh.
+type api struct {
+	fetch func() (*onsen.Onsen, error)
+	mux   *http.ServeMux
+
+	mu sync.RWMutex
+	o  *onsen.Onsen
+}
+
+func newAPI(fetch func() (*onsen.Onsen, error)) (*api, error) {
+	a := &api{
+		fetch: fetch,
+		mux:   http.NewServeMux(),
+	}
+	if err := a.refresh(); err != nil {
+		return nil, err
+	}
+
+	a.mux.HandleFunc("GET /radios", a.radios)
+	a.mux.HandleFunc("GET /radios/{name}", a.radio)
+	a.mux.HandleFunc("GET /episodes/{id}", a.episode)
+	a.mux.HandleFunc("GET /people/{id}", a.person)
+	a.mux.HandleFunc("GET /me", a.me)
+	return a, nil
+}
+
+// Fetches a new Onsen, the old one is kept on failure.
+func (a *api) refresh() error {
+	o, err := a.fetch()
+	if err != nil {
+		return err
+	}
+	// Build the indexes before it is shared by the handlers.
+	o.RadioIndex()
+	o.EpisodeIndex()
+	o.OngenIndex()
+	o.PersonIndex()
+
+	a.mu.Lock()
+	a.o = o
+	a.mu.Unlock()
+	return nil
+}
+
+func (a *api) onsen() *onsen.Onsen {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.o
+}
+
+func (a *api) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	a.mux.ServeHTTP(w, req)
+}
+
+func (a *api) radios(w http.ResponseWriter, req *http.Request) {
+	out := []radioModel{}
+	a.onsen().EachRadio(func(r onsen.Radio) {
+		out = append(out, newRadioModel(r, false))
+	})
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (a *api) radio(w http.ResponseWriter, req *http.Request) {
+	var (
+		o    = a.onsen()
+		name = req.PathValue("name")
+	)
+
+	r, ok := o.Radio(name)
+	if id, err := strconv.Atoi(name); !ok && err == nil {
+		r, ok = o.Radio(id)
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, name+": not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, newRadioModel(r, true))
+}
+
+func (a *api) episode(w http.ResponseWriter, req *http.Request) {
+	id, err := strconv.Atoi(req.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	o := a.onsen()
+	e, ok := o.Episode(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, req.PathValue("id")+": not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, newEpisodeModel(e, radioName(o, e)))
+}
+
+func (a *api) person(w http.ResponseWriter, req *http.Request) {
+	id, err := strconv.Atoi(req.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	o := a.onsen()
+	p, ok := o.Person(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, req.PathValue("id")+": not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, newPersonDetailModel(o, p))
+}
+
+func (a *api) me(w http.ResponseWriter, req *http.Request) {
+	o := a.onsen()
+	u, ok := o.User()
+	if !ok {
+		writeError(w, http.StatusNotFound, "not signed in")
+		return
+	}
+	writeJSON(w, http.StatusOK, newUserModel(o, u))
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
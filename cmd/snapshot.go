@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/adios/onsengo/snapshot"
+)
+
+var snap = struct {
+	// Directory of snapshots, see package snapshot. Shared with the diff command.
+	store string
+	list  bool
+	cmd   *cobra.Command
+}{
+	cmd: &cobra.Command{
+		Use:   "snapshot",
+		Short: "Save the current data of Onsen website into a local store",
+		Long: `
+Save the raw data of the website, as printed by the dump command, into a local
+store with the time it was taken. Use the diff command to tell what changed
+between two snapshots, or between a snapshot and the website.
+
+The store defaults to $XDG_DATA_HOME/onsengo/snapshots, or
+~/.local/share/onsengo/snapshots if XDG_DATA_HOME is not set.
+`,
+		Args: cobra.NoArgs,
+	},
+}
+
+func init() {
+	root.cmd.AddCommand(snap.cmd)
+
+	f := snap.cmd.Flags()
+	f.StringVar(&snap.store, "store", "", "set snapshot directory")
+	f.BoolVarP(&snap.list, "list", "l", false, "list snapshots instead of taking one")
+
+	snap.cmd.RunE = runSnapshot
+}
+
+func runSnapshot(cmd *cobra.Command, args []string) error {
+	s, err := openStore()
+	if err != nil {
+		return err
+	}
+
+	if snap.list {
+		ss, err := s.List()
+		if err != nil {
+			return err
+		}
+		for _, sn := range ss {
+			fmt.Fprintf(root.outw(), "%s\n", sn.Name)
+		}
+		return nil
+	}
+
+	raw, _, err := root.fetchRaw()
+	if err != nil {
+		return err
+	}
+
+	sn, err := s.Save(raw, time.Now())
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(root.outw(), "%s\n", sn.Path)
+
+	return nil
+}
+
+func openStore() (*snapshot.Store, error) {
+	dir := snap.store
+	if dir == "" {
+		data := os.Getenv("XDG_DATA_HOME")
+		if data == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, err
+			}
+			data = filepath.Join(home, ".local", "share")
+		}
+		dir = filepath.Join(data, "onsengo", "snapshots")
+	}
+	return snapshot.Open(dir)
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/adios/onsengo/onsen"
+)
+
+var syncer = struct {
+	radios []string
+	dryRun bool
+	filter filterFlags
+	dl     downloadFlags
+
+	cmd *cobra.Command
+}{
+	cmd: &cobra.Command{
+		Use:   "sync",
+		Short: "Download followed radio shows into the archive",
+		Long: `
+Mirror the radio shows followed by the session's user into the archive:
+every accessible episode which is not archived yet is downloaded, expiring
+ones first, the others are left as they are. Use --radios to sync other
+radio shows instead, and --dry-run to print the episodes to be downloaded
+without downloading them, which can be formatted by --format. The filter
+flags, e.g. --since and --where, narrow down the episodes as in lsm.
+
+  onsengo sync --archive ~/radio -s SESSION
+  onsengo sync --archive ~/radio --radios fujita,gurepap --dry-run
+  onsengo sync --archive ~/radio -s SESSION --where 'not bonus'
+
+The archive is required, downloads work the same way as get.
+`,
+	},
+}
+
+func init() {
+	root.cmd.AddCommand(syncer.cmd)
+
+	syncer.cmd.RunE = runSync
+	syncer.cmd.SilenceUsage = true
+	syncer.cmd.Flags().StringSliceVar(&syncer.radios, "radios", nil, "sync these radio names instead of the followed ones")
+	syncer.cmd.Flags().BoolVarP(&syncer.dryRun, "dry-run", "n", false, "print the episodes to be downloaded only")
+	syncer.filter.bind(syncer.cmd)
+	syncer.dl.bind(syncer.cmd)
+}
+
+func runSync(cmd *cobra.Command, args []string) error {
+	lib, err := root.library()
+	if err != nil {
+		return err
+	}
+	if lib == nil {
+		return fmt.Errorf("sync: --archive is required")
+	}
+
+	o, err := root.onsen()
+	if err != nil {
+		return err
+	}
+
+	f, err := syncer.filter.build(o)
+	if err != nil {
+		return err
+	}
+
+	rs, err := syncRadios(o, syncer.radios)
+	if err != nil {
+		return err
+	}
+
+	var es []onsen.Episode
+	for _, r := range rs {
+		for _, e := range r.Episodes() {
+			if u, _ := e.Manifest(); u == "" || lib.Has(e.Id()) || !f.Pass(e) {
+				continue
+			}
+			es = append(es, e)
+		}
+	}
+
+	es = byExpiry(es)
+
+	if syncer.dryRun {
+		t, err := root.template()
+		if err != nil {
+			return err
+		}
+		if t != nil {
+			items := make([]interface{}, len(es))
+			for i, e := range es {
+				items[i] = newEpisodeData(o, e)
+			}
+			return writeTemplate(root.outw(), t, items)
+		}
+
+		for _, e := range es {
+			fmt.Fprintf(root.outw(), "%s\n", episodeName(o, e))
+		}
+		return nil
+	}
+
+	if failed := syncer.dl.run(cmd, o, lib, es); failed > 0 {
+		return fmt.Errorf("sync: %d episode(s) failed", failed)
+	}
+	return nil
+}
+
+// Resolves the radio names, or the radios followed by the user if no names given.
+func syncRadios(o *onsen.Onsen, names []string) ([]onsen.Radio, error) {
+	var ids []interface{}
+
+	if len(names) > 0 {
+		for _, name := range unique(names) {
+			ids = append(ids, name)
+		}
+	} else {
+		u, ok := o.User()
+		if !ok {
+			return nil, fmt.Errorf("sync: no user signed in, set a session or --radios")
+		}
+		for _, id := range u.FollowingRadios() {
+			ids = append(ids, id)
+		}
+	}
+
+	var out []onsen.Radio
+	for _, id := range ids {
+		r, ok := o.Radio(id)
+		if !ok {
+			fmt.Fprintf(root.errw(), "%v: not found\n", id)
+			continue
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
@@ -0,0 +1,252 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/adios/onsengo/onsen"
+)
+
+// Template data of a radio. Methods of onsen.Radio are available, plus the ones below.
+type radioData struct {
+	onsen.Radio
+}
+
+func newRadioData(r onsen.Radio) radioData {
+	return radioData{r}
+}
+
+// The JST date in YYYY-MM-DD, empty if unknown.
+func (r radioData) Date() string {
+	return formatDate(r.JstUpdatedAt())
+}
+
+// The JST time, zero if unknown.
+func (r radioData) Time() time.Time {
+	tm, _ := r.JstUpdatedAt()
+	return tm
+}
+
+// Shadows onsen.Radio.Episodes() for the episodes to be template data as well.
+func (r radioData) Episodes() []episodeData {
+	es := r.Radio.Episodes()
+	out := make([]episodeData, len(es))
+	for i, e := range es {
+		out[i] = episodeData{Episode: e, Radio: r}
+	}
+	return out
+}
+
+// Template data of an episode. Methods of onsen.Episode are available, plus the ones below.
+type episodeData struct {
+	onsen.Episode
+	// The radio which the episode belongs to
+	Radio radioData
+}
+
+func newEpisodeData(o *onsen.Onsen, e onsen.Episode) episodeData {
+	r, _ := o.Radio(e.RadioId())
+	return episodeData{Episode: e, Radio: radioData{r}}
+}
+
+// Shadows onsen.Episode.Manifest(), empty if inaccessible.
+func (e episodeData) Manifest() string {
+	u, _ := e.Episode.Manifest()
+	return u
+}
+
+// The JST date in YYYY-MM-DD, empty if unknown.
+func (e episodeData) Date() string {
+	return formatDate(e.JstUpdatedAt())
+}
+
+// The JST time, zero if unknown.
+func (e episodeData) Time() time.Time {
+	tm, _ := e.JstUpdatedAt()
+	return tm
+}
+
+// Template data of a person. Methods of onsen.Person are available, plus the ones below.
+type personData struct {
+	onsen.Person
+	// Radios hosted, in the same order as onsen.Appearances
+	Hosted []radioData
+	// Episodes guested, in the same order as onsen.Appearances
+	Guested []episodeData
+}
+
+func newPersonData(o *onsen.Onsen, a onsen.Appearances) personData {
+	p := personData{
+		Person:  a.Person,
+		Hosted:  make([]radioData, len(a.Hosted)),
+		Guested: make([]episodeData, len(a.Guested)),
+	}
+	for i, r := range a.Hosted {
+		p.Hosted[i] = newRadioData(r)
+	}
+	for i, e := range a.Guested {
+		p.Guested[i] = newEpisodeData(o, e)
+	}
+	return p
+}
+
+// The JST date of the latest appearance in YYYY-MM-DD, empty if unknown.
+func (p personData) Date() string {
+	tm := p.Time()
+	return formatDate(tm, !tm.IsZero())
+}
+
+// The JST time of the latest appearance, zero if unknown.
+func (p personData) Time() time.Time {
+	var latest time.Time
+	for _, r := range p.Hosted {
+		if tm := r.Time(); tm.After(latest) {
+			latest = tm
+		}
+	}
+	for _, e := range p.Guested {
+		if tm := e.Time(); tm.After(latest) {
+			latest = tm
+		}
+	}
+	return latest
+}
+
+// Template data of a search result, of which only the fields of the kind are set. The radio is also set for an
+// episode.
+type matchData struct {
+	Kind    string
+	Score   int
+	Radio   *radioData
+	Episode *episodeData
+	Person  *personData
+}
+
+func newMatchData(o *onsen.Onsen, m onsen.Match) matchData {
+	out := matchData{Kind: m.Kind, Score: m.Score}
+	switch m.Kind {
+	case onsen.KindRadio:
+		r := newRadioData(m.Radio)
+		out.Radio = &r
+	case onsen.KindEpisode:
+		e := newEpisodeData(o, m.Episode)
+		out.Radio, out.Episode = &e.Radio, &e
+	case onsen.KindPerson:
+		a, _ := o.Person(m.Person.Id())
+		p := newPersonData(o, a)
+		out.Person = &p
+	}
+	return out
+}
+
+// Template data of a change, see onsen.Diff(). The radio is set for every kind, the episode for changes of episodes.
+type changeData struct {
+	Kind    string
+	Radio   radioData
+	Episode *episodeData
+	// Titles or hosts before and after the change
+	Old string
+	New string
+	// The line printed by diff
+	Line string
+}
+
+func newChangeData(c onsen.Change) changeData {
+	out := changeData{Kind: c.Kind, Radio: newRadioData(c.Radio), Old: c.Old, New: c.New, Line: formatChange(c)}
+	if c.Episode.Raw != nil {
+		// The radio may be gone from the Onsen, e.g.: removed with its episodes
+		out.Episode = &episodeData{Episode: c.Episode, Radio: out.Radio}
+	}
+	return out
+}
+
+// Template data of an event of watch, a change with the time it was found.
+type eventData struct {
+	changeData
+	Time time.Time
+}
+
+// The funcs of templates, of which letters are translated by l.
+func newTemplateFuncs(l lettering) template.FuncMap {
+	return template.FuncMap{
+		// {{jst "Jan 2" .Time}}: formats a time in JST, empty for a zero time.
+		"jst": func(layout string, tm time.Time) string {
+			if tm.IsZero() {
+				return ""
+			}
+			return tm.In(time.FixedZone("UTC+9", 9*60*60)).Format(layout)
+		},
+		// {{join ", " .Guests}}: joins names of people, or strings.
+		"join": func(sep string, v interface{}) (string, error) {
+			switch v := v.(type) {
+			case []onsen.Person:
+				names := make([]string, len(v))
+				for i, p := range v {
+					names[i] = p.Name()
+				}
+				return strings.Join(names, sep), nil
+			case []string:
+				return strings.Join(v, sep), nil
+			}
+			return "", fmt.Errorf("join: unsupported type %T", v)
+		},
+		// {{letters .}}: the letters of a radio, an episode or a person as shown by ls and people.
+		"letters": func(v interface{}) (string, error) {
+			switch v := v.(type) {
+			case radioData:
+				return l.radio(v.Radio), nil
+			case *radioData:
+				return l.radio(v.Radio), nil
+			case episodeData:
+				return l.episode(v.Episode), nil
+			case *episodeData:
+				return l.episode(v.Episode), nil
+			case personData, *personData:
+				return personLetters, nil
+			}
+			return "", fmt.Errorf("letters: unsupported type %T", v)
+		},
+	}
+}
+
+// Returns the template of --format, nil if not set.
+func (c *ctx) template() (*template.Template, error) {
+	if c.format == "" {
+		return nil, nil
+	}
+
+	// For the archived letter
+	lib, err := c.library()
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := template.New("format").Funcs(newTemplateFuncs(newLettering(lib))).Parse(c.format)
+	if err != nil {
+		return nil, fmt.Errorf("--format: %w", err)
+	}
+	return t, nil
+}
+
+// Executes the template on every item, each output is followed by a newline.
+func writeTemplate(w io.Writer, t *template.Template, items []interface{}) error {
+	for _, item := range items {
+		if err := t.Execute(w, item); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatDate(tm time.Time, ok bool) string {
+	if !ok {
+		return ""
+	}
+	return tm.Format("2006-01-02")
+}
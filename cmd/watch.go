@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/adios/onsengo/onsen"
+)
+
+var watch = struct {
+	interval time.Duration
+	exec     string
+	count    int
+	cmd      *cobra.Command
+}{
+	cmd: &cobra.Command{
+		Use:   "watch",
+		Short: "Poll Onsen website and report new episodes",
+		Long: `
+Fetch the website in an interval and report what is new since the previous
+fetch: radio shows added, episodes added and episodes became accessible. The
+first fetch is the baseline, which reports nothing.
+
+Each event is printed on a line as the diff command does, as a JSON object
+with --output ndjson, or by the template of --format. --exec runs a shell
+command for each event, with the event in JSON on stdin and the following
+environment variables:
+
+  ONSENGO_KIND        radio_added, episode_added or episode_accessible
+  ONSENGO_RADIO       the radio name
+  ONSENGO_RADIO_ID    the radio id
+  ONSENGO_EPISODE_ID  the episode id, empty for radio_added
+  ONSENGO_TITLE       the title of the episode, or the radio
+  ONSENGO_MANIFEST    the manifest URL, empty if inaccessible
+
+  onsengo watch --interval 15m --exec 'onsengo get $ONSENGO_RADIO/$ONSENGO_EPISODE_ID'
+`,
+		Args: cobra.NoArgs,
+	},
+}
+
+func init() {
+	root.cmd.AddCommand(watch.cmd)
+
+	f := watch.cmd.Flags()
+	f.DurationVar(&watch.interval, "interval", 15*time.Minute, "fetch the website in this interval")
+	f.StringVar(&watch.exec, "exec", "", "run the shell command for each event")
+	f.IntVar(&watch.count, "count", 0, "stop after fetching this many times besides the first, 0 to never stop")
+
+	watch.cmd.RunE = runWatch
+}
+
+// The kinds of changes reported as events.
+var watchKinds = map[string]bool{
+	onsen.RadioAdded:        true,
+	onsen.EpisodeAdded:      true,
+	onsen.EpisodeAccessible: true,
+}
+
+func runWatch(cmd *cobra.Command, args []string) error {
+	tmpl, err := root.template()
+	if err != nil {
+		return err
+	}
+	switch root.output {
+	case outputTable, outputNDJSON:
+	default:
+		return fmt.Errorf("watch: --output %s is not supported, use ndjson", root.output)
+	}
+	if watch.interval <= 0 {
+		return fmt.Errorf("watch: --interval must be positive")
+	}
+
+	prev, err := root.onsen()
+	if err != nil {
+		return err
+	}
+
+	t := time.NewTicker(watch.interval)
+	defer t.Stop()
+
+	for i := 0; watch.count == 0 || i < watch.count; i++ {
+		<-t.C
+
+		// A new Onsen with its indexes built from scratch
+		root.oo = nil
+		o, err := root.onsen()
+		if errors.Is(err, onsen.ErrSessionExpired) {
+			// Premium episodes would never be accessible again
+			return err
+		}
+		if err != nil {
+			fmt.Fprintf(root.errw(), "watch: %s\n", err)
+			continue
+		}
+
+		for _, c := range onsen.Diff(prev, o) {
+			if !watchKinds[c.Kind] {
+				continue
+			}
+			if err := emit(tmpl, c, time.Now()); err != nil {
+				return err
+			}
+		}
+		prev = o
+	}
+
+	return nil
+}
+
+type eventModel struct {
+	changeModel
+	Manifest string    `json:"manifest,omitempty"`
+	Time     time.Time `json:"time"`
+	// For the text output
+	line string
+}
+
+func newEventModel(c onsen.Change, tm time.Time) eventModel {
+	m := eventModel{changeModel: newChangeModel(c), Time: tm, line: formatChange(c)}
+	if c.Episode.Raw != nil {
+		m.Manifest, _ = c.Episode.Manifest()
+	}
+	return m
+}
+
+// Writes the event by tmpl if not nil and runs --exec with it, a failed command is reported without stopping the
+// watch.
+func emit(tmpl *template.Template, ch onsen.Change, tm time.Time) error {
+	m := newEventModel(ch, tm)
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case tmpl != nil:
+		if err := writeTemplate(root.outw(), tmpl, []interface{}{eventData{newChangeData(ch), tm}}); err != nil {
+			return err
+		}
+	case root.output == outputNDJSON:
+		fmt.Fprintf(root.outw(), "%s\n", b)
+	default:
+		fmt.Fprintf(root.outw(), "%s\n", m.line)
+	}
+
+	if watch.exec == "" {
+		return nil
+	}
+
+	id := ""
+	if m.EpisodeId != 0 {
+		id = strconv.Itoa(m.EpisodeId)
+	}
+
+	c := exec.Command("sh", "-c", watch.exec)
+	c.Env = append(os.Environ(),
+		"ONSENGO_KIND="+m.Kind,
+		"ONSENGO_RADIO="+m.Radio,
+		"ONSENGO_RADIO_ID="+strconv.Itoa(m.RadioId),
+		"ONSENGO_EPISODE_ID="+id,
+		"ONSENGO_TITLE="+m.Title,
+		"ONSENGO_MANIFEST="+m.Manifest,
+	)
+	stdin, err := c.StdinPipe()
+	if err != nil {
+		return err
+	}
+	// Keep stdout for the events
+	c.Stdout, c.Stderr = root.errw(), root.errw()
+
+	if err := c.Start(); err != nil {
+		fmt.Fprintf(root.errw(), "exec: %s\n", err)
+		return nil
+	}
+	stdin.Write(append(b, '\n'))
+	stdin.Close()
+	if err := c.Wait(); err != nil {
+		fmt.Fprintf(root.errw(), "exec: %s: %s\n", m.line, err)
+	}
+	return nil
+}
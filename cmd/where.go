@@ -0,0 +1,368 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/adios/onsengo/onsen"
+)
+
+// Compiles a --where expression into a FilterFn, the expression is a boolean combination of comparisons on episode
+// fields:
+//
+//	premium=false and video and date>=2021-04-01 and guest~"日高"
+//	not (bonus or expiring) or id=6505
+//
+// "not" binds tighter than "and", which binds tighter than "or". A bool field alone means field=true. Operators are
+// =, !=, <, <=, >, >= and ~ (contains, folded as in onsen.Normalize). Strings with spaces or operators are quoted in
+// "...". See whereFields for the fields and the operators they take.
+func FilterWhere(expr string) (FilterOpt, error) {
+	fn, err := compileWhere(expr)
+	if err != nil {
+		return nil, err
+	}
+	return func(f *Filter) {
+		f.chain = append(f.chain, fn)
+	}, nil
+}
+
+// A parse error of a --where expression at a position, which is 1-based in runes.
+type WhereError struct {
+	Pos int
+	Msg string
+}
+
+func (e *WhereError) Error() string {
+	return fmt.Sprintf("at %d: %s", e.Pos, e.Msg)
+}
+
+type whereKind int
+
+const (
+	whereBool whereKind = iota
+	whereInt
+	whereDate
+	whereString
+)
+
+var whereFields = map[string]struct {
+	kind whereKind
+	get  func(Episoder) interface{}
+}{
+	"id":         {whereInt, func(e Episoder) interface{} { return e.Id() }},
+	"radio_id":   {whereInt, func(e Episoder) interface{} { return e.RadioId() }},
+	"title":      {whereString, func(e Episoder) interface{} { return []string{e.Title()} }},
+	"guest":      {whereString, func(e Episoder) interface{} { return guestNames(e) }},
+	"date":       {whereDate, func(e Episoder) interface{} { tm, ok := e.JstUpdatedAt(); return jstDate(tm, ok) }},
+	"accessible": {whereBool, func(e Episoder) interface{} { _, ok := e.Manifest(); return ok }},
+	"premium":    {whereBool, func(e Episoder) interface{} { return e.RequiresPremium() }},
+	"bonus":      {whereBool, func(e Episoder) interface{} { return e.IsBonus() }},
+	"video":      {whereBool, func(e Episoder) interface{} { return e.HasVideoStream() }},
+	"latest":     {whereBool, func(e Episoder) interface{} { return e.IsLatest() }},
+	"expiring":   {whereBool, func(e Episoder) interface{} { return e.IsExpiring() }},
+}
+
+// The operators each kind of field takes.
+var whereOps = map[whereKind][]string{
+	whereBool:   {"=", "!="},
+	whereInt:    {"=", "!=", "<", "<=", ">", ">="},
+	whereDate:   {"=", "!=", "<", "<=", ">", ">="},
+	whereString: {"=", "!=", "~"},
+}
+
+func guestNames(e Episoder) []string {
+	gs := e.Guests()
+	out := make([]string, len(gs))
+	for i, p := range gs {
+		out[i] = p.Name()
+	}
+	return out
+}
+
+// Truncates a time to its JST date, nil if unknown.
+func jstDate(tm time.Time, ok bool) interface{} {
+	if !ok {
+		return nil
+	}
+	return onsen.JstDate(tm)
+}
+
+type whereToken struct {
+	// One of "(", ")", an operator, "word" and "string"
+	kind string
+	text string
+	pos  int
+}
+
+func lexWhere(expr string) ([]whereToken, error) {
+	var (
+		out []whereToken
+		pos = 1
+		rs  = []rune(expr)
+	)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			out = append(out, whereToken{string(r), string(r), pos + i})
+			i++
+		case strings.ContainsRune("=!<>~", r):
+			op := string(r)
+			if i+1 < len(rs) && rs[i+1] == '=' && r != '=' && r != '~' {
+				op += "="
+			}
+			if op == "!" {
+				return nil, &WhereError{pos + i, `expected "!="`}
+			}
+			out = append(out, whereToken{op, op, pos + i})
+			i += utf8.RuneCountInString(op)
+		case r == '"':
+			j := i + 1
+			for ; j < len(rs) && rs[j] != '"'; j++ {
+				if rs[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(rs) {
+				return nil, &WhereError{pos + i, "unterminated string"}
+			}
+			s, err := strconv.Unquote(string(rs[i : j+1]))
+			if err != nil {
+				return nil, &WhereError{pos + i, "invalid string " + string(rs[i:j+1])}
+			}
+			out = append(out, whereToken{"string", s, pos + i})
+			i = j + 1
+		default:
+			j := i
+			for ; j < len(rs) && !unicode.IsSpace(rs[j]) && !strings.ContainsRune(`()=!<>~"`, rs[j]); j++ {
+			}
+			out = append(out, whereToken{"word", string(rs[i:j]), pos + i})
+			i = j
+		}
+	}
+	return out, nil
+}
+
+type whereParser struct {
+	ts []whereToken
+	i  int
+	// The position of the end, for errors on a missing token
+	end int
+}
+
+func compileWhere(expr string) (FilterFn, error) {
+	ts, err := lexWhere(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &whereParser{ts: ts, end: utf8.RuneCountInString(expr) + 1}
+	if len(ts) == 0 {
+		return nil, &WhereError{1, "empty expression"}
+	}
+
+	fn, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := p.peek(); ok {
+		return nil, &WhereError{t.pos, fmt.Sprintf("unexpected %q", t.text)}
+	}
+	return fn, nil
+}
+
+func (p *whereParser) peek() (whereToken, bool) {
+	if p.i >= len(p.ts) {
+		return whereToken{}, false
+	}
+	return p.ts[p.i], true
+}
+
+// Consumes the next token if it is the keyword.
+func (p *whereParser) keyword(kw string) bool {
+	t, ok := p.peek()
+	if ok && t.kind == "word" && strings.EqualFold(t.text, kw) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *whereParser) or() (FilterFn, error) {
+	fn, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		a := fn
+		b, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		fn = func(e Episoder) bool { return a(e) || b(e) }
+	}
+	return fn, nil
+}
+
+func (p *whereParser) and() (FilterFn, error) {
+	fn, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		a := fn
+		b, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		fn = func(e Episoder) bool { return a(e) && b(e) }
+	}
+	return fn, nil
+}
+
+func (p *whereParser) unary() (FilterFn, error) {
+	if p.keyword("not") {
+		fn, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(e Episoder) bool { return !fn(e) }, nil
+	}
+	return p.primary()
+}
+
+func (p *whereParser) primary() (FilterFn, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, &WhereError{p.end, "expected a field or \"(\""}
+	}
+	p.i++
+
+	switch t.kind {
+	case "(":
+		fn, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if c, ok := p.peek(); !ok || c.kind != ")" {
+			return nil, &WhereError{t.pos, "unclosed \"(\""}
+		}
+		p.i++
+		return fn, nil
+	case "word":
+		return p.comparison(t)
+	}
+	return nil, &WhereError{t.pos, fmt.Sprintf("expected a field, got %q", t.text)}
+}
+
+func (p *whereParser) comparison(name whereToken) (FilterFn, error) {
+	f, ok := whereFields[strings.ToLower(name.text)]
+	if !ok {
+		var names []string
+		for k := range whereFields {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		return nil, &WhereError{name.pos, fmt.Sprintf("unknown field %q, must be one of %s", name.text, strings.Join(names, ", "))}
+	}
+
+	op, ok := p.peek()
+	if !ok || !isWhereOp(op.kind) {
+		if f.kind == whereBool {
+			return func(e Episoder) bool { return f.get(e).(bool) }, nil
+		}
+		return nil, &WhereError{name.pos, fmt.Sprintf("expected an operator after %q", name.text)}
+	}
+	p.i++
+
+	valid := false
+	for _, o := range whereOps[f.kind] {
+		valid = valid || o == op.kind
+	}
+	if !valid {
+		return nil, &WhereError{op.pos, fmt.Sprintf("%q takes %s, not %q", name.text, strings.Join(whereOps[f.kind], " "), op.kind)}
+	}
+
+	v, ok := p.peek()
+	if !ok || (v.kind != "word" && v.kind != "string") {
+		return nil, &WhereError{op.pos, fmt.Sprintf("expected a value after %q", op.kind)}
+	}
+	p.i++
+
+	switch f.kind {
+	case whereBool:
+		b, err := strconv.ParseBool(v.text)
+		if err != nil {
+			return nil, &WhereError{v.pos, fmt.Sprintf("%q is a bool, got %q", name.text, v.text)}
+		}
+		return func(e Episoder) bool { return (f.get(e).(bool) == b) == (op.kind == "=") }, nil
+	case whereInt:
+		n, err := strconv.Atoi(v.text)
+		if err != nil {
+			return nil, &WhereError{v.pos, fmt.Sprintf("%q is a number, got %q", name.text, v.text)}
+		}
+		return func(e Episoder) bool { return compare(op.kind, f.get(e).(int)-n) }, nil
+	case whereDate:
+		var d JstHyphenDate
+		if err := d.Set(v.text); err != nil {
+			return nil, &WhereError{v.pos, fmt.Sprintf("%q is a date in YYYY-MM-DD, got %q", name.text, v.text)}
+		}
+		return func(e Episoder) bool {
+			tm, ok := f.get(e).(time.Time)
+			if !ok {
+				// Unknown dates compare to nothing
+				return false
+			}
+			return compare(op.kind, tm.Compare(time.Time(d)))
+		}, nil
+	}
+
+	// whereString matches if any of the values matches, or none of them for !=
+	want := v.text
+	return func(e Episoder) bool {
+		for _, s := range f.get(e).([]string) {
+			switch op.kind {
+			case "~":
+				if strings.Contains(onsen.Normalize(s), onsen.Normalize(want)) {
+					return true
+				}
+			default:
+				if s == want {
+					return op.kind == "="
+				}
+			}
+		}
+		return op.kind == "!="
+	}, nil
+}
+
+func isWhereOp(kind string) bool {
+	switch kind {
+	case "=", "!=", "<", "<=", ">", ">=", "~":
+		return true
+	}
+	return false
+}
+
+// Tells whether a three-way comparison result satisfies the operator.
+func compare(op string, c int) bool {
+	switch op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
@@ -0,0 +1,185 @@
+// Package cookies loads cookies exported from browsers into an http.CookieJar.
+//
+// Two formats are supported: the Netscape cookies.txt, as exported by browser extensions and used by curl and yt-dlp,
+// and JSON exports, either an array of cookies as exported by extensions like Cookie-Editor:
+//
+//	[{"domain": ".onsen.ag", "hostOnly": false, "path": "/", "secure": true, "expirationDate": 1700000000,
+//	  "name": "_session_id", "value": "..."}]
+//
+// or an object of such an array in "cookies", as the storage state of Playwright, where "expires" is the expiration.
+//
+// Domains of parsed cookies start with "." if they match subdomains, otherwise they match the host only.
+package cookies
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reads cookies from a file in either format.
+func Load(path string) ([]*http.Cookie, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cs []*http.Cookie
+	switch t := bytes.TrimSpace(b); {
+	case len(t) > 0 && (t[0] == '[' || t[0] == '{'):
+		cs, err = ParseJSON(t)
+	default:
+		cs, err = ParseNetscape(bytes.NewReader(b))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Load: %s: %w", path, err)
+	}
+	return cs, nil
+}
+
+// Parses a Netscape cookies.txt, of which each line is a cookie in tab-separated fields:
+//
+//	domain  include_subdomains  path  secure  expiration  name  value
+//
+// Lines starting with "#" are comments, except "#HttpOnly_" which marks an HttpOnly cookie.
+func ParseNetscape(r io.Reader) ([]*http.Cookie, error) {
+	var (
+		out []*http.Cookie
+		sc  = bufio.NewScanner(r)
+		n   = 0
+	)
+	for sc.Scan() {
+		n++
+		line := strings.TrimRight(sc.Text(), "\r")
+
+		httpOnly := strings.HasPrefix(line, "#HttpOnly_")
+		if httpOnly {
+			line = strings.TrimPrefix(line, "#HttpOnly_")
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fs := strings.Split(line, "\t")
+		if len(fs) != 7 {
+			return nil, fmt.Errorf("ParseNetscape: line %d: %d fields, want 7 separated by tabs", n, len(fs))
+		}
+		exp, err := strconv.ParseInt(fs[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("ParseNetscape: line %d: invalid expiration %q", n, fs[4])
+		}
+
+		c := &http.Cookie{
+			Name:     fs[5],
+			Value:    fs[6],
+			Path:     fs[2],
+			Domain:   domain(fs[0], !strings.EqualFold(fs[1], "TRUE")),
+			Secure:   strings.EqualFold(fs[3], "TRUE"),
+			HttpOnly: httpOnly,
+		}
+		if exp > 0 {
+			c.Expires = time.Unix(exp, 0)
+		}
+		out = append(out, c)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("ParseNetscape: %w", err)
+	}
+	return out, nil
+}
+
+type jsonCookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Domain   string `json:"domain"`
+	HostOnly *bool  `json:"hostOnly"`
+	Path     string `json:"path"`
+	Secure   bool   `json:"secure"`
+	HttpOnly bool   `json:"httpOnly"`
+	// Seconds since the epoch, absent or not positive for session cookies
+	ExpirationDate float64 `json:"expirationDate"`
+	Expires        float64 `json:"expires"`
+}
+
+// Parses a JSON export of cookies, an array of cookies or an object of them in "cookies".
+func ParseJSON(b []byte) ([]*http.Cookie, error) {
+	var jcs []jsonCookie
+	if err := json.Unmarshal(b, &jcs); err != nil {
+		var state struct {
+			Cookies []jsonCookie `json:"cookies"`
+		}
+		if err := json.Unmarshal(b, &state); err != nil {
+			return nil, fmt.Errorf("ParseJSON: %w", err)
+		}
+		jcs = state.Cookies
+	}
+
+	out := make([]*http.Cookie, 0, len(jcs))
+	for i, jc := range jcs {
+		if jc.Name == "" || jc.Domain == "" {
+			return nil, fmt.Errorf("ParseJSON: cookie %d: name and domain are required", i+1)
+		}
+
+		// Domains starting with "." match subdomains, unless told otherwise
+		hostOnly := !strings.HasPrefix(jc.Domain, ".")
+		if jc.HostOnly != nil {
+			hostOnly = *jc.HostOnly
+		}
+		path := jc.Path
+		if path == "" {
+			path = "/"
+		}
+
+		c := &http.Cookie{
+			Name:     jc.Name,
+			Value:    jc.Value,
+			Path:     path,
+			Domain:   domain(jc.Domain, hostOnly),
+			Secure:   jc.Secure,
+			HttpOnly: jc.HttpOnly,
+		}
+		if exp := math.Max(jc.ExpirationDate, jc.Expires); exp > 0 {
+			c.Expires = time.Unix(int64(exp), 0)
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+func domain(d string, hostOnly bool) string {
+	d = strings.TrimPrefix(d, ".")
+	if hostOnly {
+		return d
+	}
+	return "." + d
+}
+
+// Returns a jar of the cookies, as if each is set by its domain. Expired cookies are dropped.
+func NewJar(cs []*http.Cookie) (http.CookieJar, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range cs {
+		u := &url.URL{Scheme: "https", Host: strings.TrimPrefix(c.Domain, "."), Path: c.Path}
+
+		cc := *c
+		if !strings.HasPrefix(c.Domain, ".") {
+			// Host-only cookies have no domain attribute
+			cc.Domain = ""
+		}
+		jar.SetCookies(u, []*http.Cookie{&cc})
+	}
+	return jar, nil
+}
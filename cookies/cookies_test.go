@@ -0,0 +1,119 @@
+package cookies
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const netscape = `# Netscape HTTP Cookie File
+# This file is generated by a browser extension.
+
+#HttpOnly_.onsen.ag	TRUE	/	TRUE	4102444800	_session_id	SESSION
+www.onsen.ag	FALSE	/	FALSE	0	locale	ja
+.onsen.ag	TRUE	/program	FALSE	4102444800	visited	1
+.onsen.ag	TRUE	/	FALSE	946684800	expired	1
+.example.com	TRUE	/	FALSE	0	other	1
+`
+
+func names(jar http.CookieJar, rawurl string) string {
+	u, _ := url.Parse(rawurl)
+	var out []string
+	for _, c := range jar.Cookies(u) {
+		out = append(out, c.Name+"="+c.Value)
+	}
+	sort.Strings(out)
+	return strings.Join(out, "; ")
+}
+
+func TestParseNetscape(t *testing.T) {
+	assert := assert.New(t)
+
+	cs, err := ParseNetscape(strings.NewReader(netscape))
+	assert.NoError(err)
+	assert.Len(cs, 5)
+	assert.Equal(&http.Cookie{
+		Name: "_session_id", Value: "SESSION", Path: "/", Domain: ".onsen.ag",
+		Secure: true, HttpOnly: true, Expires: time.Unix(4102444800, 0),
+	}, cs[0])
+	assert.Equal(&http.Cookie{Name: "locale", Value: "ja", Path: "/", Domain: "www.onsen.ag"}, cs[1])
+
+	jar, err := NewJar(cs)
+	assert.NoError(err)
+	assert.Equal("_session_id=SESSION; locale=ja", names(jar, "https://www.onsen.ag/"))
+	assert.Equal("_session_id=SESSION", names(jar, "https://onsen.ag/"))
+	assert.Equal("_session_id=SESSION; visited=1", names(jar, "https://onsen.ag/program/fujita"))
+	assert.Equal("", names(jar, "http://onsen.ag/"), "secure cookies over https only")
+	assert.Equal("other=1", names(jar, "https://cdn.example.com/"))
+
+	_, err = ParseNetscape(strings.NewReader("onsen.ag TRUE / FALSE 0 a b\n"))
+	assert.EqualError(err, "ParseNetscape: line 1: 1 fields, want 7 separated by tabs")
+	_, err = ParseNetscape(strings.NewReader("onsen.ag\tTRUE\t/\tFALSE\tnever\ta\tb\n"))
+	assert.EqualError(err, `ParseNetscape: line 1: invalid expiration "never"`)
+}
+
+func TestParseJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	{
+		// Cookie-Editor
+		cs, err := ParseJSON([]byte(`[
+			{"domain": ".onsen.ag", "hostOnly": false, "httpOnly": true, "name": "_session_id", "path": "/",
+			 "secure": true, "session": false, "expirationDate": 4102444800.5, "value": "SESSION"},
+			{"domain": "www.onsen.ag", "hostOnly": true, "name": "locale", "path": "/", "session": true, "value": "ja"}
+		]`))
+		assert.NoError(err)
+		assert.Equal(&http.Cookie{
+			Name: "_session_id", Value: "SESSION", Path: "/", Domain: ".onsen.ag",
+			Secure: true, HttpOnly: true, Expires: time.Unix(4102444800, 0),
+		}, cs[0])
+		assert.Equal(&http.Cookie{Name: "locale", Value: "ja", Path: "/", Domain: "www.onsen.ag"}, cs[1])
+	}
+	{
+		// Playwright
+		cs, err := ParseJSON([]byte(`{"cookies": [
+			{"name": "_session_id", "value": "SESSION", "domain": "onsen.ag", "path": "/", "expires": -1}
+		], "origins": []}`))
+		assert.NoError(err)
+		assert.Equal(&http.Cookie{Name: "_session_id", Value: "SESSION", Path: "/", Domain: "onsen.ag"}, cs[0])
+
+		jar, _ := NewJar(cs)
+		assert.Equal("_session_id=SESSION", names(jar, "http://onsen.ag/"))
+		assert.Equal("", names(jar, "https://www.onsen.ag/"), "host only")
+	}
+
+	_, err := ParseJSON([]byte(`[{"name": "a"}]`))
+	assert.EqualError(err, "ParseJSON: cookie 1: name and domain are required")
+	_, err = ParseJSON([]byte(`"cookies"`))
+	assert.Error(err)
+}
+
+func TestLoad(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		dir    = t.TempDir()
+		txt    = filepath.Join(dir, "cookies.txt")
+		js     = filepath.Join(dir, "cookies.json")
+	)
+	os.WriteFile(txt, []byte(netscape), 0600)
+	os.WriteFile(js, []byte(`  [{"domain": "onsen.ag", "name": "a", "value": "b"}]`), 0600)
+
+	cs, err := Load(txt)
+	assert.NoError(err)
+	assert.Len(cs, 5)
+
+	cs, err = Load(js)
+	assert.NoError(err)
+	assert.Len(cs, 1)
+
+	os.WriteFile(js, []byte(`[{}]`), 0600)
+	_, err = Load(js)
+	assert.EqualError(err, "Load: "+js+": ParseJSON: cookie 1: name and domain are required")
+}
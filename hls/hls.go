@@ -0,0 +1,336 @@
+package hls
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Fetches a resource by its URL. The caller decides the client, headers and cookies to use.
+type Fetcher func(url string) (*http.Response, error)
+
+// Downloader resolves a manifest to its media playlist and downloads all the segments.
+type Downloader struct {
+	fetch  Fetcher
+	choose func([]Variant) Variant
+
+	// Number of segments downloaded in parallel by DownloadFile()
+	jobs int
+	// Number of retries after a failed request, each waits for backoff and doubles it.
+	retries int
+	backoff time.Duration
+
+	// Keys by their URIs, a key is usually shared by all the segments of a playlist.
+	mu   sync.Mutex
+	keys map[string][]byte
+}
+
+type DownloaderOpt func(*Downloader)
+
+// Sets the function to pick a variant from a master playlist. Defaults to HighestBandwidth.
+func WithVariant(fn func([]Variant) Variant) DownloaderOpt {
+	return func(d *Downloader) {
+		d.choose = fn
+	}
+}
+
+// Sets the number of segments to download in parallel. Defaults to 1.
+func WithJobs(n int) DownloaderOpt {
+	return func(d *Downloader) {
+		if n < 1 {
+			n = 1
+		}
+		d.jobs = n
+	}
+}
+
+// Retries a failed request n times, waits for backoff before the first retry and doubles it on each retry.
+// Client errors (4xx) are not retried. Defaults to no retries.
+func WithRetry(n int, backoff time.Duration) DownloaderOpt {
+	return func(d *Downloader) {
+		d.retries = n
+		d.backoff = backoff
+	}
+}
+
+func NewDownloader(fetch Fetcher, opts ...DownloaderOpt) *Downloader {
+	d := &Downloader{
+		fetch:  fetch,
+		choose: HighestBandwidth,
+		jobs:   1,
+		keys:   make(map[string][]byte),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Returns the media playlist of the manifest. If the manifest is a master playlist, a variant is chosen and its
+// media playlist is fetched.
+func (d *Downloader) Playlist(manifest string) (*Playlist, error) {
+	p, err := d.playlist(manifest)
+	if err != nil {
+		return nil, err
+	}
+	if !p.IsMaster() {
+		return p, nil
+	}
+
+	v := d.choose(p.Variants)
+
+	p, err = d.playlist(v.URI)
+	if err != nil {
+		return nil, err
+	}
+	if p.IsMaster() {
+		return nil, fmt.Errorf("Playlist: %s: nested master playlist", v.URI)
+	}
+	return p, nil
+}
+
+// Downloads all the segments of the manifest and writes them in order to w.
+func (d *Downloader) Download(manifest string, w io.Writer) error {
+	p, err := d.Playlist(manifest)
+	if err != nil {
+		return err
+	}
+	return d.DownloadPlaylist(p, w)
+}
+
+// Downloads all the segments of a media playlist and writes them in order to w. Encrypted segments are decrypted.
+func (d *Downloader) DownloadPlaylist(p *Playlist, w io.Writer) error {
+	for _, s := range p.Segments {
+		b, err := d.segment(s)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Downloads all the segments of a media playlist into the file at path, resuming an earlier attempt if any.
+//
+// Segments are downloaded in parallel into the OUTPUT.parts directory and recorded in the OUTPUT.journal file as
+// they complete. The first failure stops the download, the parts and the journal are left so that the next call only
+// downloads the missing segments. Once all the segments are there, they are concatenated into the output, the parts
+// and the journal are removed.
+func (d *Downloader) DownloadFile(p *Playlist, path string) error {
+	j, err := openJournal(path, p.Segments)
+	if err != nil {
+		return err
+	}
+
+	var (
+		missing = j.missing(len(p.Segments))
+		todo    = make(chan int)
+		// Closed on the first failure, so that the rest are not downloaded in vain, e.g. on an expired URL.
+		done  = make(chan struct{})
+		once  sync.Once
+		first error
+		wg    sync.WaitGroup
+	)
+
+	fail := func(err error) {
+		once.Do(func() {
+			first = err
+			close(done)
+		})
+	}
+
+	for n := 0; n < d.jobs; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range todo {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				b, err := d.segment(p.Segments[i])
+				if err == nil {
+					err = j.commit(i, b)
+				}
+				if err != nil {
+					fail(err)
+					return
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, i := range missing {
+		select {
+		case todo <- i:
+		case <-done:
+			break feed
+		}
+	}
+	close(todo)
+	wg.Wait()
+
+	if err := j.close(); err != nil {
+		return err
+	}
+	// Report the first failure only, the others are stopped by it.
+	if first != nil {
+		return first
+	}
+
+	if err := j.assemble(path, len(p.Segments)); err != nil {
+		return err
+	}
+	return j.remove()
+}
+
+func (d *Downloader) playlist(uri string) (*Playlist, error) {
+	b, err := d.read(uri)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(bytes.NewReader(b), uri)
+}
+
+// Returns the content of a segment, decrypted if needed.
+func (d *Downloader) segment(s Segment) ([]byte, error) {
+	b, err := d.read(s.URI)
+	if err != nil {
+		return nil, err
+	}
+	if s.Key == nil {
+		return b, nil
+	}
+	return d.decrypt(b, s)
+}
+
+// Decrypts an AES-128 encrypted segment, the only method supported.
+func (d *Downloader) decrypt(b []byte, s Segment) ([]byte, error) {
+	if s.Key.Method != "AES-128" {
+		return nil, fmt.Errorf("%s: unsupported encryption method %s", s.URI, s.Key.Method)
+	}
+
+	key, err := d.key(s.Key.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	iv := s.Key.IV
+	if iv == nil {
+		// The media sequence number as a big-endian 128-bit integer.
+		iv = make([]byte, aes.BlockSize)
+		binary.BigEndian.PutUint64(iv[8:], uint64(s.Sequence))
+	}
+
+	if len(b) == 0 || len(b)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("%s: invalid encrypted length %d", s.URI, len(b))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(b, b)
+
+	// PKCS7 padding
+	n := int(b[len(b)-1])
+	if n == 0 || n > aes.BlockSize {
+		return nil, fmt.Errorf("%s: invalid padding, possibly a wrong key", s.URI)
+	}
+	return b[:len(b)-n], nil
+}
+
+// Returns the key at uri, it's fetched with the same Fetcher (and thus the session) as the segments.
+func (d *Downloader) key(uri string) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if k, ok := d.keys[uri]; ok {
+		return k, nil
+	}
+
+	k, err := d.read(uri)
+	if err != nil {
+		return nil, err
+	}
+	if len(k) != 16 {
+		return nil, fmt.Errorf("%s: invalid key length %d", uri, len(k))
+	}
+
+	d.keys[uri] = k
+	return k, nil
+}
+
+// Reads the whole content at uri, retries on failures according to WithRetry().
+func (d *Downloader) read(uri string) ([]byte, error) {
+	backoff := d.backoff
+
+	for n := 0; ; n++ {
+		b, err := d.readOnce(uri)
+		if err == nil {
+			return b, nil
+		}
+		if se, ok := err.(*StatusError); (ok && se.Code < 500) || n >= d.retries {
+			return nil, err
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (d *Downloader) readOnce(uri string) ([]byte, error) {
+	resp, err := d.fetch(uri)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &StatusError{uri, resp.StatusCode, resp.Status}
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Returned when a request gets a non-2xx response.
+type StatusError struct {
+	URL    string
+	Code   int
+	Status string
+}
+
+func (e *StatusError) Error() string {
+	return e.URL + ": " + e.Status
+}
+
+// Picks the variant with the highest bandwidth.
+func HighestBandwidth(vs []Variant) Variant {
+	best := vs[0]
+	for _, v := range vs[1:] {
+		if v.Bandwidth > best.Bandwidth {
+			best = v
+		}
+	}
+	return best
+}
+
+// Picks the variant with the lowest bandwidth.
+func LowestBandwidth(vs []Variant) Variant {
+	best := vs[0]
+	for _, v := range vs[1:] {
+		if v.Bandwidth < best.Bandwidth {
+			best = v
+		}
+	}
+	return best
+}
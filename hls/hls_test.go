@@ -0,0 +1,292 @@
+package hls
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const master = `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-STREAM-INF:BANDWIDTH=64000,CODECS="mp4a.40.2"
+low/chunklist.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=1280000,CODECS="mp4a.40.2,avc1.4d401f",RESOLUTION=640x360
+high/chunklist.m3u8
+`
+
+const media = `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:3
+#EXTINF:10.0,
+media_3.ts
+#EXTINF:10.0,
+media_4.ts
+#EXTINF:4.5,
+/abs/media_5.ts
+#EXT-X-ENDLIST
+`
+
+func TestParse(t *testing.T) {
+	assert := assert.New(t)
+
+	{
+		_, err := Parse(strings.NewReader(""), "http://a/")
+		assert.EqualError(err, "Parse: missing #EXTM3U header")
+		_, err = Parse(strings.NewReader("#EXTINF:10,\na.ts\n"), "http://a/")
+		assert.EqualError(err, "Parse: missing #EXTM3U header")
+	}
+	{
+		p, err := Parse(strings.NewReader(master), "http://a/b/playlist.m3u8")
+		assert.NoError(err)
+		assert.True(p.IsMaster())
+		assert.Equal([]Variant{
+			{"http://a/b/low/chunklist.m3u8", 64000, "", "mp4a.40.2"},
+			{"http://a/b/high/chunklist.m3u8", 1280000, "640x360", "mp4a.40.2,avc1.4d401f"},
+		}, p.Variants)
+		assert.Equal("http://a/b/high/chunklist.m3u8", HighestBandwidth(p.Variants).URI)
+		assert.Equal("http://a/b/low/chunklist.m3u8", LowestBandwidth(p.Variants).URI)
+	}
+	{
+		p, err := Parse(strings.NewReader(media), "http://a/b/chunklist.m3u8")
+		assert.NoError(err)
+		assert.False(p.IsMaster())
+		assert.Equal(10, p.TargetDuration)
+		assert.Equal(3, p.MediaSequence)
+		assert.True(p.EndList)
+		assert.Equal([]Segment{
+			{"http://a/b/media_3.ts", 10, 3, nil},
+			{"http://a/b/media_4.ts", 10, 4, nil},
+			{"http://a/abs/media_5.ts", 4.5, 5, nil},
+		}, p.Segments)
+		assert.Equal(".ts", p.Ext())
+	}
+	{
+		p, _ := Parse(strings.NewReader("#EXTM3U\n#EXTINF:1,\nx.aac?token=1\n"), "http://a/")
+		assert.Equal(".aac", p.Ext())
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		f, _   = os.Open("testdata/fixture_aes128/playlist.m3u8")
+	)
+	defer f.Close()
+
+	p, err := Parse(f, "http://a/b/playlist.m3u8")
+	assert.NoError(err)
+	assert.Len(p.Segments, 3)
+	assert.Equal(
+		&Key{"AES-128", "http://a/b/key.bin", []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}},
+		p.Segments[0].Key,
+	)
+	assert.Equal(&Key{"AES-128", "http://a/b/key.bin", nil}, p.Segments[1].Key)
+	assert.Equal(8, p.Segments[1].Sequence)
+	assert.Nil(p.Segments[2].Key, "METHOD=NONE clears the key")
+
+	_, err = Parse(strings.NewReader("#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"k\",IV=0x01\n"), "http://a/")
+	assert.EqualError(err, "Parse: invalid IV 0x01")
+}
+
+func TestParseAttributes(t *testing.T) {
+	assert.Equal(
+		t,
+		map[string]string{"A": "1", "B": "x,y", "C": "z"},
+		parseAttributes(`A=1,B="x,y",C=z`),
+	)
+}
+
+func TestDownload(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		mux    = http.NewServeMux()
+		server = httptest.NewServer(mux)
+	)
+	defer server.Close()
+
+	mux.HandleFunc("/playlist.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, master)
+	})
+	mux.HandleFunc("/high/chunklist.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, strings.Replace(media, "/abs/", "", 1))
+	})
+	mux.HandleFunc("/high/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	})
+
+	{
+		var (
+			out strings.Builder
+			d   = NewDownloader(http.Get)
+		)
+		assert.NoError(d.Download(server.URL+"/playlist.m3u8", &out))
+		assert.Equal("/high/media_3.ts/high/media_4.ts/high/media_5.ts", out.String())
+	}
+	{
+		var (
+			out strings.Builder
+			d   = NewDownloader(http.Get, WithVariant(LowestBandwidth))
+		)
+		err := d.Download(server.URL+"/playlist.m3u8", &out)
+		assert.EqualError(err, server.URL+"/low/chunklist.m3u8: 404 Not Found")
+	}
+}
+
+func TestDownloadEncrypted(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		files    = http.FileServer(http.Dir("testdata/fixture_aes128"))
+		expected = func() string {
+			b, _ := os.ReadFile("testdata/fixture_aes128/expected.ts")
+			return string(b)
+		}()
+		keyFetched int
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/key.bin" {
+			// Keys require a session
+			if c, err := r.Cookie("_session_id"); err != nil || c.Value != "SESSION" {
+				http.Error(w, "", http.StatusForbidden)
+				return
+			}
+			keyFetched++
+		}
+		files.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	withSession := func(url string) (*http.Response, error) {
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Add("Cookie", "_session_id=SESSION")
+		return http.DefaultClient.Do(req)
+	}
+
+	{
+		var out strings.Builder
+		assert.NoError(NewDownloader(withSession).Download(server.URL+"/playlist.m3u8", &out))
+		assert.Equal(expected, out.String())
+		assert.Equal(1, keyFetched, "Key is fetched once and cached")
+	}
+	{
+		var out strings.Builder
+		err := NewDownloader(http.Get).Download(server.URL+"/playlist.m3u8", &out)
+		assert.EqualError(err, server.URL+"/key.bin: 403 Forbidden")
+	}
+}
+
+func TestDownloadFile(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		out    = filepath.Join(t.TempDir(), "out.ts")
+
+		mu       sync.Mutex
+		requests = make(map[string]int)
+		// Number of failures to respond before a segment is served
+		failures = map[string]int{"/media_1.ts": 1, "/media_3.ts": 1000}
+		status   = map[string]int{"/media_1.ts": 503, "/media_3.ts": 404}
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		requests[r.URL.Path]++
+		if requests[r.URL.Path] <= failures[r.URL.Path] {
+			w.WriteHeader(status[r.URL.Path])
+			return
+		}
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer server.Close()
+
+	p, _ := Parse(strings.NewReader(
+		"#EXTM3U\n#EXTINF:1,\nmedia_0.ts\n#EXTINF:1,\nmedia_1.ts\n#EXTINF:1,\nmedia_2.ts\n#EXTINF:1,\nmedia_3.ts\n"),
+		server.URL+"/chunklist.m3u8",
+	)
+
+	{
+		// media_1.ts is retried, media_3.ts is a client error thus not retried.
+		d := NewDownloader(http.Get, WithJobs(3), WithRetry(2, time.Millisecond))
+		err := d.DownloadFile(p, out)
+		assert.EqualError(err, server.URL+"/media_3.ts: 404 Not Found")
+		assert.Equal(2, requests["/media_1.ts"])
+		assert.Equal(1, requests["/media_3.ts"])
+		assert.True(HasJournal(out))
+
+		_, err = os.Stat(out)
+		assert.True(os.IsNotExist(err))
+
+		b, _ := os.ReadFile(out + ".journal")
+		assert.Equal(4, strings.Count(string(b), "\n"), "header and 3 completed segments")
+	}
+	{
+		// Resume: only the missing segment is downloaded, and a tampered part is downloaded again.
+		failures["/media_3.ts"] = 0
+		os.WriteFile(filepath.Join(out+".parts", "2"), []byte("tampered"), 0644)
+
+		d := NewDownloader(http.Get, WithJobs(3))
+		assert.NoError(d.DownloadFile(p, out))
+		assert.Equal(1, requests["/media_0.ts"])
+		assert.Equal(2, requests["/media_1.ts"])
+		assert.Equal(2, requests["/media_2.ts"])
+		assert.Equal(2, requests["/media_3.ts"])
+
+		b, _ := os.ReadFile(out)
+		assert.Equal("/media_0.ts/media_1.ts/media_2.ts/media_3.ts", string(b))
+		assert.False(HasJournal(out))
+
+		_, err := os.Stat(out + ".parts")
+		assert.True(os.IsNotExist(err))
+	}
+	{
+		// A journal of another playlist with as many segments is discarded.
+		failures["/other_3.ts"], status["/other_3.ts"] = 1000, 404
+		other, _ := Parse(strings.NewReader(
+			"#EXTM3U\n#EXTINF:1,\nother_0.ts\n#EXTINF:1,\nother_1.ts\n#EXTINF:1,\nother_2.ts\n#EXTINF:1,\nother_3.ts\n"),
+			server.URL+"/chunklist.m3u8",
+		)
+
+		d := NewDownloader(http.Get, WithJobs(3))
+		assert.Error(d.DownloadFile(other, out))
+		assert.True(HasJournal(out))
+
+		// Queries are not told apart.
+		q, _ := Parse(strings.NewReader(
+			"#EXTM3U\n#EXTINF:1,\nother_0.ts?t=1\n#EXTINF:1,\nother_1.ts?t=1\n#EXTINF:1,\nother_2.ts?t=1\n#EXTINF:1,\nother_3.ts?t=1\n"),
+			server.URL+"/chunklist.m3u8",
+		)
+		assert.Error(d.DownloadFile(q, out))
+		assert.Equal(1, requests["/other_0.ts"])
+
+		assert.NoError(d.DownloadFile(p, out))
+		assert.Equal(2, requests["/media_0.ts"])
+		assert.Equal(3, requests["/media_3.ts"])
+
+		b, _ := os.ReadFile(out)
+		assert.Equal("/media_0.ts/media_1.ts/media_2.ts/media_3.ts", string(b))
+	}
+	{
+		// The first failure stops the rest from being downloaded.
+		failures["/stop_0.ts"], status["/stop_0.ts"] = 1000, 403
+		stop, _ := Parse(strings.NewReader(
+			"#EXTM3U\n#EXTINF:1,\nstop_0.ts\n#EXTINF:1,\nstop_1.ts\n#EXTINF:1,\nstop_2.ts\n#EXTINF:1,\nstop_3.ts\n"),
+			server.URL+"/chunklist.m3u8",
+		)
+
+		d := NewDownloader(http.Get, WithRetry(2, time.Millisecond))
+		err := d.DownloadFile(stop, filepath.Join(t.TempDir(), "stop.ts"))
+		assert.EqualError(err, server.URL+"/stop_0.ts: 403 Forbidden")
+		assert.Equal(1, requests["/stop_0.ts"])
+		assert.Zero(requests["/stop_1.ts"] + requests["/stop_2.ts"] + requests["/stop_3.ts"])
+	}
+}
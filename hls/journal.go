@@ -0,0 +1,252 @@
+package hls
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A journal records the segments which have been downloaded into the parts directory, so that an interrupted
+// download can be resumed. It is a file of JSON lines next to the output:
+//
+//	{"segments":120,"playlist":"3b1c4e..."}
+//	{"index":0,"size":376412,"sha256":"9f86d0..."}
+//	{"index":2,"size":375284,"sha256":"60303a..."}
+//	...
+//
+// The first line is the header, a journal made for a playlist with different segments is discarded. Segments are told
+// by their URIs without queries, which often carry tokens that expire between attempts.
+type journal struct {
+	path  string
+	parts string
+
+	mu   sync.Mutex
+	f    *os.File
+	done map[int]JournalEntry
+}
+
+type journalHeader struct {
+	Segments int `json:"segments"`
+	// SHA-256 of the segment URIs
+	Playlist string `json:"playlist"`
+}
+
+// Returns the header of a journal for the segments.
+func newJournalHeader(segments []Segment) journalHeader {
+	h := sha256.New()
+	for _, s := range segments {
+		uri, _, _ := strings.Cut(s.URI, "?")
+		io.WriteString(h, uri+"\n")
+	}
+	return journalHeader{len(segments), hex.EncodeToString(h.Sum(nil))}
+}
+
+// Represents a completed segment in a journal.
+type JournalEntry struct {
+	Index  int    `json:"index"`
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256"`
+}
+
+// Returns the paths of the journal and the parts directory for an output.
+func journalPaths(output string) (path, parts string) {
+	return output + ".journal", output + ".parts"
+}
+
+// Opens the journal of the output, loads and verifies its entries. An entry whose part is missing or mismatched is
+// dropped, and thus the segment will be downloaded again.
+func openJournal(output string, ss []Segment) (*journal, error) {
+	var (
+		path, parts = journalPaths(output)
+		header      = newJournalHeader(ss)
+		segments    = len(ss)
+	)
+
+	j := &journal{
+		path:  path,
+		parts: parts,
+		done:  make(map[int]JournalEntry),
+	}
+
+	if entries, ok := readJournal(path, header); ok {
+		for _, e := range entries {
+			if j.verify(e) {
+				j.done[e.Index] = e
+			}
+		}
+	}
+
+	if err := os.MkdirAll(parts, 0755); err != nil {
+		return nil, err
+	}
+
+	// Rewrite the journal with the verified entries only.
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	j.f = f
+
+	if err := j.write(header); err != nil {
+		f.Close()
+		return nil, err
+	}
+	for i := 0; i < segments; i++ {
+		if e, ok := j.done[i]; ok {
+			if err := j.write(e); err != nil {
+				f.Close()
+				return nil, err
+			}
+		}
+	}
+	return j, nil
+}
+
+// Reads the entries of a journal, ok is false if there is no journal or it's made for another playlist.
+func readJournal(path string, header journalHeader) (entries []JournalEntry, ok bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	if !sc.Scan() {
+		return nil, false
+	}
+
+	var h journalHeader
+	if err := json.Unmarshal(sc.Bytes(), &h); err != nil || h != header {
+		return nil, false
+	}
+
+	for sc.Scan() {
+		var e JournalEntry
+		// A torn line from an interruption is ignored.
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			continue
+		}
+		if e.Index >= 0 && e.Index < header.Segments {
+			entries = append(entries, e)
+		}
+	}
+	return entries, true
+}
+
+func (j *journal) verify(e JournalEntry) bool {
+	b, err := os.ReadFile(j.part(e.Index))
+	if err != nil || int64(len(b)) != e.Size {
+		return false
+	}
+	return checksum(b) == e.Sha256
+}
+
+// Returns the indexes of the segments not yet downloaded.
+func (j *journal) missing(segments int) []int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var out []int
+	for i := 0; i < segments; i++ {
+		if _, ok := j.done[i]; !ok {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// Writes the part of a segment and records it.
+func (j *journal) commit(index int, b []byte) error {
+	tmp := j.part(index) + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, j.part(index)); err != nil {
+		return err
+	}
+
+	e := JournalEntry{index, int64(len(b)), checksum(b)}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.done[index] = e
+	return j.write(e)
+}
+
+func (j *journal) write(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = j.f.Write(append(b, '\n'))
+	return err
+}
+
+func (j *journal) part(index int) string {
+	return filepath.Join(j.parts, strconv.Itoa(index))
+}
+
+func (j *journal) close() error {
+	return j.f.Close()
+}
+
+// Concatenates the parts into the output.
+func (j *journal) assemble(path string, segments int) error {
+	tmp := path + ".part"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < segments; i++ {
+		if err := j.copyPart(f, i); err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (j *journal) copyPart(w io.Writer, index int) error {
+	f, err := os.Open(j.part(index))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// Removes the journal and the parts, called once the output is assembled.
+func (j *journal) remove() error {
+	if err := os.RemoveAll(j.parts); err != nil {
+		return err
+	}
+	return os.Remove(j.path)
+}
+
+// Returns true if there's an unfinished download for the output.
+func HasJournal(output string) bool {
+	path, _ := journalPaths(output)
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,238 @@
+// Package hls implements a minimal HTTP Live Streaming client, enough to download the episodes behind the m3u8
+// manifests of onsen.ag.
+//
+// A manifest returned by onsen.Episode.Manifest() is usually a master playlist which points to one or more
+// variant (media) playlists, each of them lists the segments of the stream:
+//
+//	playlist.m3u8          master playlist
+//	└── chunklist.m3u8     media playlist, chosen by the downloader
+//	    ├── media_0.ts     segment
+//	    ├── media_1.ts     segment
+//	    └── ...
+package hls
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Represents an #EXT-X-STREAM-INF entry of a master playlist.
+type Variant struct {
+	URI        string
+	Bandwidth  int
+	Resolution string
+	Codecs     string
+}
+
+// Represents an #EXTINF entry of a media playlist.
+type Segment struct {
+	URI      string
+	Duration float64
+	// The media sequence number of the segment.
+	Sequence int
+	// The key to decrypt the segment, nil if the segment is not encrypted.
+	Key *Key
+}
+
+// Represents an #EXT-X-KEY entry of a media playlist.
+type Key struct {
+	Method string
+	URI    string
+	// Explicit initialization vector, nil if the IV attribute is absent. In which case the media sequence number of
+	// the segment is used.
+	IV []byte
+}
+
+// Represents either a master playlist (has Variants) or a media playlist (has Segments).
+type Playlist struct {
+	Variants       []Variant
+	Segments       []Segment
+	TargetDuration int
+	MediaSequence  int
+	EndList        bool
+}
+
+func (p *Playlist) IsMaster() bool {
+	return len(p.Variants) > 0
+}
+
+// Guesses the container format from the segments, returns ".aac" for packed audio and ".ts" for MPEG-TS.
+func (p *Playlist) Ext() string {
+	for _, s := range p.Segments {
+		u, err := url.Parse(s.URI)
+		if err != nil {
+			continue
+		}
+		switch ext := strings.ToLower(path.Ext(u.Path)); ext {
+		case ".aac", ".ts":
+			return ext
+		}
+	}
+	return ".ts"
+}
+
+// Parses a m3u8 playlist from r. Relative URIs are resolved against base, which is normally the URL where the
+// playlist is fetched from.
+func Parse(r io.Reader, base string) (*Playlist, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		p       = &Playlist{}
+		sc      = bufio.NewScanner(r)
+		header  bool
+		inf     *Segment
+		variant *Variant
+		key     *Key
+	)
+
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		if !header {
+			if line != "#EXTM3U" {
+				return nil, fmt.Errorf("Parse: missing #EXTM3U header")
+			}
+			header = true
+			continue
+		}
+
+		tag, value := splitTag(line)
+
+		switch tag {
+		case "#EXT-X-TARGETDURATION":
+			p.TargetDuration, _ = strconv.Atoi(value)
+		case "#EXT-X-MEDIA-SEQUENCE":
+			p.MediaSequence, _ = strconv.Atoi(value)
+		case "#EXT-X-ENDLIST":
+			p.EndList = true
+		case "#EXTINF":
+			d, _ := strconv.ParseFloat(strings.SplitN(value, ",", 2)[0], 64)
+			inf = &Segment{Duration: d, Key: key}
+		case "#EXT-X-KEY":
+			key, err = parseKey(value, b)
+			if err != nil {
+				return nil, err
+			}
+		case "#EXT-X-STREAM-INF":
+			attrs := parseAttributes(value)
+			bw, _ := strconv.Atoi(attrs["BANDWIDTH"])
+			variant = &Variant{
+				Bandwidth:  bw,
+				Resolution: attrs["RESOLUTION"],
+				Codecs:     attrs["CODECS"],
+			}
+		default:
+			if strings.HasPrefix(line, "#") {
+				// Unsupported tags and comments
+				continue
+			}
+
+			u, err := b.Parse(line)
+			if err != nil {
+				return nil, fmt.Errorf("Parse: %w", err)
+			}
+
+			switch {
+			case variant != nil:
+				variant.URI = u.String()
+				p.Variants = append(p.Variants, *variant)
+				variant = nil
+			case inf != nil:
+				inf.URI = u.String()
+				inf.Sequence = p.MediaSequence + len(p.Segments)
+				p.Segments = append(p.Segments, *inf)
+				inf = nil
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if !header {
+		return nil, fmt.Errorf("Parse: missing #EXTM3U header")
+	}
+
+	return p, nil
+}
+
+// Parses the attributes of #EXT-X-KEY. Returns nil for METHOD=NONE.
+func parseKey(value string, base *url.URL) (*Key, error) {
+	attrs := parseAttributes(value)
+
+	if attrs["METHOD"] == "NONE" {
+		return nil, nil
+	}
+
+	k := &Key{Method: attrs["METHOD"]}
+
+	if uri, ok := attrs["URI"]; ok {
+		u, err := base.Parse(uri)
+		if err != nil {
+			return nil, fmt.Errorf("Parse: %w", err)
+		}
+		k.URI = u.String()
+	}
+
+	if iv, ok := attrs["IV"]; ok {
+		b, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(iv, "0x"), "0X"))
+		if err != nil || len(b) != 16 {
+			return nil, fmt.Errorf("Parse: invalid IV %s", iv)
+		}
+		k.IV = b
+	}
+	return k, nil
+}
+
+// Splits "#TAG:VALUE" into its tag and value.
+func splitTag(line string) (tag, value string) {
+	if i := strings.IndexByte(line, ':'); i >= 0 && strings.HasPrefix(line, "#") {
+		return line[:i], line[i+1:]
+	}
+	return line, ""
+}
+
+// Parses an attribute list, e.g.: BANDWIDTH=1280000,CODECS="mp4a.40.2,avc1.4d401f",RESOLUTION=640x360
+func parseAttributes(s string) map[string]string {
+	out := make(map[string]string)
+
+	for len(s) > 0 {
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.TrimSpace(s[:eq])
+		s = s[eq+1:]
+
+		var value string
+		if strings.HasPrefix(s, "\"") {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				value, s = s[1:], ""
+			} else {
+				value, s = s[1:end+1], s[end+2:]
+			}
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				value, s = s, ""
+			} else {
+				value, s = s[:end], s[end:]
+			}
+		}
+		out[key] = value
+
+		s = strings.TrimPrefix(s, ",")
+	}
+	return out
+}
@@ -0,0 +1,150 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Sends a message somewhere.
+type Notifier interface {
+	Notify(m Message) error
+}
+
+// Posts the message as a JSON object to the URL:
+//
+//	{"subject", "body", "radio_id", "radio", "radio_title", "episode_id", "title", "guests", "manifest"}
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+func (w Webhook) Notify(m Message) error {
+	guests := []string{}
+	for _, p := range m.Episode.Guests() {
+		guests = append(guests, p.Name())
+	}
+	manifest, _ := m.Episode.Manifest()
+
+	return postJSON(w.Client, w.URL, map[string]interface{}{
+		"subject":     m.Subject,
+		"body":        m.Body,
+		"radio_id":    m.Radio.Id(),
+		"radio":       m.Radio.Name(),
+		"radio_title": m.Radio.Title(),
+		"episode_id":  m.Episode.Id(),
+		"title":       m.Episode.Title(),
+		"guests":      guests,
+		"manifest":    manifest,
+	})
+}
+
+// Posts the message to a Discord webhook, as {"content": "SUBJECT\nBODY"}.
+type Discord struct {
+	URL    string
+	Client *http.Client
+}
+
+// The limit of Discord on the content.
+const discordMaxContent = 2000
+
+func (d Discord) Notify(m Message) error {
+	content := []rune(join(m.Subject, m.Body))
+	if len(content) > discordMaxContent {
+		content = append(content[:discordMaxContent-1], '…')
+	}
+	return postJSON(d.Client, d.URL, map[string]string{"content": string(content)})
+}
+
+// Posts the message to a Slack incoming webhook, or a compatible one, as {"text": "SUBJECT\nBODY"}.
+type Slack struct {
+	URL    string
+	Client *http.Client
+}
+
+func (s Slack) Notify(m Message) error {
+	return postJSON(s.Client, s.URL, map[string]string{"text": join(m.Subject, m.Body)})
+}
+
+func join(subject, body string) string {
+	if body == "" {
+		return subject
+	}
+	return subject + "\n" + body
+}
+
+func postJSON(hc *http.Client, url string, v interface{}) error {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	resp, err := hc.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return nil
+}
+
+// Sends the message as a plain text email through an SMTP server. Username and Password are used with PLAIN auth if
+// set, which requires TLS unless the server is on localhost.
+type Mail struct {
+	// host:port
+	Addr     string
+	From     string
+	To       []string
+	Username string
+	Password string
+}
+
+func (ml Mail) Notify(m Message) error {
+	var auth smtp.Auth
+	if ml.Username != "" {
+		host, _, err := net.SplitHostPort(ml.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", ml.Username, ml.Password, host)
+	}
+	return smtp.SendMail(ml.Addr, auth, ml.From, ml.To, ml.message(m, time.Now()))
+}
+
+func (ml Mail) message(m Message, now time.Time) []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "From: %s\r\n", ml.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(ml.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.BEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n")
+	b.WriteString("\r\n")
+
+	body := base64.StdEncoding.EncodeToString([]byte(m.Body))
+	for len(body) > 76 {
+		b.WriteString(body[:76] + "\r\n")
+		body = body[76:]
+	}
+	b.WriteString(body + "\r\n")
+
+	return b.Bytes()
+}
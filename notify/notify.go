@@ -0,0 +1,300 @@
+// Package notify sends notifications of episodes to webhooks, Discord, Slack and email, by rules on radio shows and
+// performers.
+//
+// The rules are configured in a JSON file, notifiers are named and referred to by the rules:
+//
+//	{
+//	  "notifiers": {
+//	    "team": {"type": "discord", "url": "https://discord.com/api/webhooks/..."},
+//	    "me":   {"type": "smtp", "addr": "smtp.example.com:587", "from": "onsengo@example.com", "to": ["me@example.com"],
+//	             "username": "me", "password": "..."}
+//	  },
+//	  "rules": [
+//	    {"radios": ["fujita", "gurepap"], "notify": ["team"]},
+//	    {"people": ["日高里菜"], "notify": ["me"], "subject": "{{.Radio.Title}} with {{join \", \" .Episode.Guests}}"}
+//	  ]
+//	}
+//
+// The types of notifiers are webhook, discord, slack and smtp. Subjects and bodies are Go templates of Data.
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/adios/onsengo/onsen"
+)
+
+const (
+	DefaultSubject = `{{.Radio.Title}} {{.Episode.Title}}`
+	DefaultBody    = `{{.Radio.Title}}
+{{.Episode.Title}}{{with .Episode.Guests}}
+ゲスト: {{join ", " .}}{{end}}
+https://www.onsen.ag/program/{{.Radio.Name}}
+`
+)
+
+type Config struct {
+	Notifiers map[string]NotifierConfig `json:"notifiers"`
+	Rules     []Rule                    `json:"rules"`
+}
+
+type NotifierConfig struct {
+	// One of webhook, discord, slack and smtp
+	Type string `json:"type"`
+	// for webhook, discord and slack
+	URL string `json:"url,omitempty"`
+	// for smtp
+	Addr     string   `json:"addr,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       []string `json:"to,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+}
+
+// An episode matches a rule if its radio is one of Radios, or one of People hosts the radio or guests in the episode,
+// or its radio is followed by the user if Following is set. A rule without any of them matches every episode.
+type Rule struct {
+	// Names or ids of radios
+	Radios []string `json:"radios,omitempty"`
+	// Names or ids of people
+	People    []string `json:"people,omitempty"`
+	Following bool     `json:"following,omitempty"`
+	// Names of notifiers
+	Notify []string `json:"notify"`
+	// Templates, DefaultSubject and DefaultBody if empty
+	Subject string `json:"subject,omitempty"`
+	Body    string `json:"body,omitempty"`
+}
+
+// The data of subject and body templates.
+type Data struct {
+	Radio   onsen.Radio
+	Episode onsen.Episode
+}
+
+// A rendered message to a notifier.
+type Message struct {
+	// The name of the notifier
+	To      string
+	Subject string
+	Body    string
+	Radio   onsen.Radio
+	Episode onsen.Episode
+}
+
+var funcs = template.FuncMap{
+	// {{join ", " .Episode.Guests}}: joins names of people.
+	"join": func(sep string, ps []onsen.Person) string {
+		names := make([]string, len(ps))
+		for i, p := range ps {
+			names[i] = p.Name()
+		}
+		return strings.Join(names, sep)
+	},
+}
+
+type route struct {
+	Rule
+	subject *template.Template
+	body    *template.Template
+}
+
+// Routes episodes to notifiers by the rules.
+type Router struct {
+	notifiers map[string]Notifier
+	routes    []route
+}
+
+// Reads the config from a JSON file, see New().
+func Load(path string, hc *http.Client) (*Router, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var c Config
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("Load: %s: %w", path, err)
+	}
+	r, err := New(c, hc)
+	if err != nil {
+		return nil, fmt.Errorf("Load: %s: %w", path, err)
+	}
+	return r, nil
+}
+
+// Validates the config and creates the notifiers, which post with the client, http.DefaultClient if nil.
+func New(c Config, hc *http.Client) (*Router, error) {
+	r := &Router{notifiers: make(map[string]Notifier)}
+
+	for name, nc := range c.Notifiers {
+		n, err := newNotifier(nc, hc)
+		if err != nil {
+			return nil, fmt.Errorf("notifier %q: %w", name, err)
+		}
+		r.notifiers[name] = n
+	}
+
+	for i, rule := range c.Rules {
+		if len(rule.Notify) == 0 {
+			return nil, fmt.Errorf("rule %d: no notifier to notify", i+1)
+		}
+		for _, name := range rule.Notify {
+			if _, ok := r.notifiers[name]; !ok {
+				return nil, fmt.Errorf("rule %d: unknown notifier %q", i+1, name)
+			}
+		}
+
+		if rule.Subject == "" {
+			rule.Subject = DefaultSubject
+		}
+		if rule.Body == "" {
+			rule.Body = DefaultBody
+		}
+		rt := route{Rule: rule}
+		var err error
+		if rt.subject, err = template.New("subject").Funcs(funcs).Parse(rule.Subject); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		if rt.body, err = template.New("body").Funcs(funcs).Parse(rule.Body); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		r.routes = append(r.routes, rt)
+	}
+
+	return r, nil
+}
+
+func newNotifier(c NotifierConfig, hc *http.Client) (Notifier, error) {
+	switch c.Type {
+	case "webhook", "discord", "slack":
+		if c.URL == "" {
+			return nil, fmt.Errorf("%s requires url", c.Type)
+		}
+	}
+
+	switch c.Type {
+	case "webhook":
+		return Webhook{URL: c.URL, Client: hc}, nil
+	case "discord":
+		return Discord{URL: c.URL, Client: hc}, nil
+	case "slack":
+		return Slack{URL: c.URL, Client: hc}, nil
+	case "smtp":
+		if c.Addr == "" || c.From == "" || len(c.To) == 0 {
+			return nil, fmt.Errorf("smtp requires addr, from and to")
+		}
+		return Mail{Addr: c.Addr, From: c.From, To: c.To, Username: c.Username, Password: c.Password}, nil
+	}
+	return nil, fmt.Errorf("unknown type %q, must be one of webhook, discord, slack and smtp", c.Type)
+}
+
+// Returns the messages of the episode by the matched rules. A notifier gets one message per episode, rendered by the
+// first rule matched.
+func (r *Router) Messages(o *onsen.Onsen, e onsen.Episode) ([]Message, error) {
+	radio, ok := o.Radio(e.RadioId())
+	if !ok {
+		return nil, fmt.Errorf("Messages: radio %d of episode %d: not found", e.RadioId(), e.Id())
+	}
+
+	var (
+		out  []Message
+		sent = make(map[string]bool)
+		data = Data{Radio: radio, Episode: e}
+	)
+	for _, rt := range r.routes {
+		if !rt.match(o, radio, e) {
+			continue
+		}
+
+		var subject, body strings.Builder
+		if err := rt.subject.Execute(&subject, data); err != nil {
+			return nil, err
+		}
+		if err := rt.body.Execute(&body, data); err != nil {
+			return nil, err
+		}
+
+		for _, name := range rt.Notify {
+			if sent[name] {
+				continue
+			}
+			sent[name] = true
+			out = append(out, Message{
+				To:      name,
+				Subject: strings.TrimSpace(subject.String()),
+				Body:    body.String(),
+				Radio:   radio,
+				Episode: e,
+			})
+		}
+	}
+	return out, nil
+}
+
+// Sends the message to its notifier.
+func (r *Router) Send(m Message) error {
+	n, ok := r.notifiers[m.To]
+	if !ok {
+		return fmt.Errorf("Send: unknown notifier %q", m.To)
+	}
+	if err := n.Notify(m); err != nil {
+		return fmt.Errorf("Send: %s: %w", m.To, err)
+	}
+	return nil
+}
+
+// Sends the messages of the episode, and returns the errors of all the failed ones.
+func (r *Router) Notify(o *onsen.Onsen, e onsen.Episode) error {
+	ms, err := r.Messages(o, e)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, m := range ms {
+		if err := r.Send(m); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (rt route) match(o *onsen.Onsen, r onsen.Radio, e onsen.Episode) bool {
+	if len(rt.Radios) == 0 && len(rt.People) == 0 && !rt.Following {
+		return true
+	}
+
+	for _, s := range rt.Radios {
+		if s == r.Name() || s == strconv.Itoa(r.Id()) {
+			return true
+		}
+	}
+
+	people := append(append([]onsen.Person{}, r.Hosts()...), e.Guests()...)
+	for _, s := range rt.People {
+		for _, p := range people {
+			if s == p.Name() || s == strconv.Itoa(p.Id()) {
+				return true
+			}
+		}
+	}
+
+	if rt.Following {
+		if u, ok := o.User(); ok {
+			for _, id := range u.FollowingRadios() {
+				if id == r.Id() {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,263 @@
+package notify
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adios/onsengo/onsen"
+)
+
+func fixture(t *testing.T) *onsen.Onsen {
+	b, err := os.ReadFile("../onsen/testdata/fixture_nologin_screened.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := onsen.CreateFromRawData(string(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+// Receives requests in JSON and sends them over the channel.
+func hookServer(status int) (*httptest.Server, chan map[string]interface{}) {
+	ch := make(chan map[string]interface{}, 10)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var v map[string]interface{}
+		json.NewDecoder(req.Body).Decode(&v)
+		ch <- v
+		w.WriteHeader(status)
+	})), ch
+}
+
+// Accepts a mail on a connection and sends its data over the channel.
+func smtpServer(t *testing.T) (addr string, ch chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	ch = make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var (
+			r    = bufio.NewReader(conn)
+			data strings.Builder
+		)
+		io.WriteString(conn, "220 localhost\r\n")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.Fields(line)[0]); cmd {
+			case "EHLO", "HELO", "MAIL", "RCPT":
+				data.WriteString(line)
+				io.WriteString(conn, "250 OK\r\n")
+			case "DATA":
+				io.WriteString(conn, "354 Go ahead\r\n")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				io.WriteString(conn, "250 OK\r\n")
+			case "QUIT":
+				io.WriteString(conn, "221 Bye\r\n")
+				ch <- data.String()
+				return
+			default:
+				io.WriteString(conn, "502 Unsupported\r\n")
+			}
+		}
+	}()
+	return l.Addr().String(), ch
+}
+
+func TestNew(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, test := range []struct {
+		config Config
+		err    string
+	}{
+		{Config{Notifiers: map[string]NotifierConfig{"x": {Type: "irc"}}}, `notifier "x": unknown type "irc", must be one of webhook, discord, slack and smtp`},
+		{Config{Notifiers: map[string]NotifierConfig{"x": {Type: "discord"}}}, `notifier "x": discord requires url`},
+		{Config{Notifiers: map[string]NotifierConfig{"x": {Type: "smtp", Addr: "localhost:25"}}}, `notifier "x": smtp requires addr, from and to`},
+		{Config{Rules: []Rule{{Radios: []string{"fujita"}}}}, `rule 1: no notifier to notify`},
+		{Config{Rules: []Rule{{Notify: []string{"x"}}}}, `rule 1: unknown notifier "x"`},
+		{
+			Config{
+				Notifiers: map[string]NotifierConfig{"x": {Type: "slack", URL: "http://localhost"}},
+				Rules:     []Rule{{Notify: []string{"x"}, Subject: "{{.Radio.Title"}},
+			},
+			`rule 1: template: subject:1: unclosed action`,
+		},
+	} {
+		_, err := New(test.config, nil)
+		assert.EqualError(err, test.err)
+	}
+
+	path := filepath.Join(t.TempDir(), "rules.json")
+	os.WriteFile(path, []byte(`{"notifiers": {"x": {"type": "webhook", "url": "http://localhost"}}, "rules": [{"notify": ["x"]}]}`), 0644)
+	_, err := Load(path, nil)
+	assert.NoError(err)
+
+	os.WriteFile(path, []byte(`{"rules": [{"notify": ["x"]}]}`), 0644)
+	_, err = Load(path, nil)
+	assert.EqualError(err, "Load: "+path+`: rule 1: unknown notifier "x"`)
+}
+
+func TestRouter(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		o        = fixture(t)
+		hook, hc = hookServer(http.StatusOK)
+		disc, dc = hookServer(http.StatusNoContent)
+		slack, _ = hookServer(http.StatusInternalServerError)
+	)
+	defer hook.Close()
+	defer disc.Close()
+	defer slack.Close()
+
+	r, err := New(Config{
+		Notifiers: map[string]NotifierConfig{
+			"hook":    {Type: "webhook", URL: hook.URL},
+			"discord": {Type: "discord", URL: disc.URL},
+			"slack":   {Type: "slack", URL: slack.URL},
+		},
+		Rules: []Rule{
+			{Radios: []string{"gurepa"}, Notify: []string{"hook"}, Subject: "{{.Radio.Name}}/{{.Episode.Id}}", Body: "{{join \"/\" .Radio.Hosts}}"},
+			{People: []string{"天津向"}, Notify: []string{"discord", "hook"}},
+			{Radios: []string{"97"}, Notify: []string{"slack"}},
+		},
+	}, nil)
+	assert.NoError(err)
+
+	{
+		// gurepa/5667 第80回 # 天津向
+		e, _ := o.Episode(5667)
+		ms, err := r.Messages(o, e)
+		assert.NoError(err)
+		assert.Len(ms, 2)
+
+		assert.Equal("hook", ms[0].To)
+		assert.Equal("gurepa/5667", ms[0].Subject)
+		assert.Equal("鷲崎健/藤田茜", ms[0].Body)
+
+		assert.Equal("discord", ms[1].To)
+		assert.Equal("鷲崎健・藤田茜のグレパラジオ 第80回", ms[1].Subject)
+		assert.Equal("鷲崎健・藤田茜のグレパラジオ\n第80回\nゲスト: 天津向\nhttps://www.onsen.ag/program/gurepa\n", ms[1].Body)
+
+		assert.NoError(r.Notify(o, e))
+
+		v := <-hc
+		assert.Equal("gurepa/5667", v["subject"])
+		assert.Equal("gurepa", v["radio"])
+		assert.Equal(float64(5667), v["episode_id"])
+		assert.Equal("第80回", v["title"])
+		assert.Equal([]interface{}{"天津向"}, v["guests"])
+
+		v = <-dc
+		assert.Equal("鷲崎健・藤田茜のグレパラジオ 第80回\n"+ms[1].Body, v["content"])
+	}
+	{
+		// fate-apocrypha/6559 第2回 matches nothing
+		e, _ := o.Episode(6559)
+		ms, err := r.Messages(o, e)
+		assert.NoError(err)
+		assert.Empty(ms)
+	}
+	{
+		r, _ := o.Radio("fujita")
+		e := r.Episodes()[0]
+		sr, _ := New(Config{
+			Notifiers: map[string]NotifierConfig{"slack": {Type: "slack", URL: slack.URL}},
+			Rules:     []Rule{{Radios: []string{"fujita"}, Notify: []string{"slack"}}},
+		}, nil)
+		err := sr.Notify(o, e)
+		assert.Error(err)
+		assert.Contains(err.Error(), "Send: slack: "+slack.URL+": 500 Internal Server Error")
+	}
+}
+
+func TestRouterFollowing(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		b, _   = os.ReadFile("../onsen/testdata/fixture_paid_screened.json")
+		o, _   = onsen.CreateFromRawData(string(b))
+	)
+
+	r, err := New(Config{
+		Notifiers: map[string]NotifierConfig{"x": {Type: "webhook", URL: "http://localhost"}},
+		Rules:     []Rule{{Following: true, Notify: []string{"x"}}},
+	}, nil)
+	assert.NoError(err)
+
+	u, ok := o.User()
+	assert.True(ok)
+
+	followed := make(map[int]bool)
+	for _, id := range u.FollowingRadios() {
+		followed[id] = true
+	}
+	o.EachRadio(func(radio onsen.Radio) {
+		for _, e := range radio.Episodes() {
+			ms, err := r.Messages(o, e)
+			assert.NoError(err)
+			assert.Equal(followed[radio.Id()], len(ms) == 1, radio.Name())
+		}
+	})
+}
+
+func TestMail(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		o        = fixture(t)
+		addr, ch = smtpServer(t)
+		e, _     = o.Episode(5667)
+		radio, _ = o.Radio(e.RadioId())
+		mail     = Mail{Addr: addr, From: "onsengo@example.com", To: []string{"a@example.com", "b@example.com"}}
+		m        = Message{Subject: "グレパラ 第80回", Body: "ゲスト: 天津向\n", Radio: radio, Episode: e}
+	)
+
+	assert.NoError(mail.Notify(m))
+
+	select {
+	case data := <-ch:
+		assert.Contains(data, "MAIL FROM:<onsengo@example.com>")
+		assert.Contains(data, "RCPT TO:<a@example.com>")
+		assert.Contains(data, "RCPT TO:<b@example.com>")
+		assert.Contains(data, "To: a@example.com, b@example.com\r\n")
+		assert.Contains(data, "Subject: =?utf-8?b?44Kw44Os44OR44OpIOesrDgw5Zue?=\r\n")
+		assert.Contains(data, "\r\n\r\n"+base64.StdEncoding.EncodeToString([]byte(m.Body))+"\r\n")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail received")
+	}
+
+	// Long bodies are wrapped
+	b := mail.message(Message{Body: strings.Repeat("あ", 100)}, time.Now())
+	for _, line := range strings.Split(string(b), "\r\n") {
+		assert.LessOrEqual(len(line), 76)
+	}
+}
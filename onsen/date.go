@@ -0,0 +1,109 @@
+package onsen
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Truncates a time to the midnight of its date in JST.
+func JstDate(tm time.Time) time.Time {
+	loc := time.FixedZone("UTC+9", 9*60*60)
+	y, m, d := tm.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc)
+}
+
+// Parses a date string in "YYYY-MM-DD" format as the midnight in JST.
+func ParseJstDate(date string) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02", date, time.FixedZone("UTC+9", 9*60*60))
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday, "日": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday, "月": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday, "火": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday, "水": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday, "木": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday, "金": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday, "土": time.Saturday,
+}
+
+// Parses a weekday in English, full or abbreviated, or in Japanese, e.g.: "fri", "Friday", "金" and "金曜日".
+func ParseWeekday(s string) (time.Weekday, error) {
+	key := strings.TrimSuffix(strings.TrimSuffix(strings.ToLower(s), "日"), "曜")
+	if key == "" {
+		// "日" alone is Sunday
+		key = strings.ToLower(s)
+	}
+	d, ok := weekdays[key]
+	if !ok {
+		return 0, fmt.Errorf("ParseWeekday: unknown weekday %q", s)
+	}
+	return d, nil
+}
+
+// Given a date string and a referenced time, returns the midnight of the date in JST. The string is one of:
+//
+//	YYYY-MM-DD    the date
+//	today         the date of the referenced time
+//	yesterday     the day before
+//	7d, 2w        the days or weeks before
+//	last-friday   the latest friday before, a week before if it is a friday
+func ParseJstRelativeDate(s string, ref time.Time) (time.Time, error) {
+	today := JstDate(ref)
+
+	switch s = strings.ToLower(s); s {
+	case "today":
+		return today, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	}
+
+	if m := regexp.MustCompile("^([0-9]+)([dw])$").FindStringSubmatch(s); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("ParseJstRelativeDate: %w", err)
+		}
+		if m[2] == "w" {
+			n *= 7
+		}
+		return today.AddDate(0, 0, -n), nil
+	}
+
+	if strings.HasPrefix(s, "last-") {
+		d, err := ParseWeekday(strings.TrimPrefix(s, "last-"))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("ParseJstRelativeDate: %w", err)
+		}
+		days := (int(today.Weekday()) - int(d) + 7) % 7
+		if days == 0 {
+			days = 7
+		}
+		return today.AddDate(0, 0, -days), nil
+	}
+
+	tm, err := ParseJstDate(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("ParseJstRelativeDate: %q must be YYYY-MM-DD, today, yesterday, 7d, 2w or last-friday", s)
+	}
+	return tm, nil
+}
+
+// SIDE EFFECT: this function has side effect, set a fixed date by SetRefDate() when testing its value.
+//
+// ParseJstRelativeDate() relative to now.
+func ParseJstRelativeDateWithNow(s string) (time.Time, error) {
+	return ParseJstRelativeDate(s, guessRefTime)
+}
+
+// Whether the radio is delivered on the weekday according to its Schedule().
+func (r Radio) IsDeliveredOn(d time.Weekday) bool {
+	for _, s := range r.Schedule() {
+		if s == d {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package onsen
+
+import (
+	"strings"
+)
+
+// Kinds of changes reported by Diff().
+const (
+	RadioAdded          = "radio_added"
+	RadioRemoved        = "radio_removed"
+	EpisodeAdded        = "episode_added"
+	EpisodeRemoved      = "episode_removed"
+	EpisodeInaccessible = "episode_inaccessible"
+	EpisodeAccessible   = "episode_accessible"
+	EpisodePremium      = "episode_premium"
+	TitleChanged        = "title_changed"
+	HostsChanged        = "hosts_changed"
+)
+
+// A change between two states of the website. Radio is always set, Episode is set for the changes of episodes and for
+// title changes of episodes. Old and New are set for title and hosts changes, hosts are joined by ", ".
+type Change struct {
+	Kind    string
+	Radio   Radio
+	Episode Episode
+	Old     string
+	New     string
+}
+
+// Returns the changes from a to b in the order of b.Radios(), and then the radios removed in the order of
+// a.Radios(). Radios and episodes are matched by their ids.
+func Diff(a, b *Onsen) []Change {
+	out := []Change{}
+
+	b.EachRadio(func(r Radio) {
+		old, ok := a.Radio(r.Id())
+		if !ok {
+			out = append(out, Change{Kind: RadioAdded, Radio: r})
+			return
+		}
+		if old.Title() != r.Title() {
+			out = append(out, Change{Kind: TitleChanged, Radio: r, Old: old.Title(), New: r.Title()})
+		}
+		if o, n := joinHosts(old), joinHosts(r); o != n {
+			out = append(out, Change{Kind: HostsChanged, Radio: r, Old: o, New: n})
+		}
+		out = append(out, diffEpisodes(a, old, r)...)
+	})
+
+	a.EachRadio(func(r Radio) {
+		if _, ok := b.Radio(r.Id()); !ok {
+			out = append(out, Change{Kind: RadioRemoved, Radio: r})
+		}
+	})
+
+	return out
+}
+
+func diffEpisodes(a *Onsen, old, r Radio) []Change {
+	var (
+		out  []Change
+		seen = make(map[int]bool)
+	)
+	for _, e := range r.Episodes() {
+		seen[e.Id()] = true
+
+		prev, ok := a.Episode(e.Id())
+		if !ok {
+			out = append(out, Change{Kind: EpisodeAdded, Radio: r, Episode: e})
+			continue
+		}
+		if prev.Title() != e.Title() {
+			out = append(out, Change{Kind: TitleChanged, Radio: r, Episode: e, Old: prev.Title(), New: e.Title()})
+		}
+		_, was := prev.Manifest()
+		_, is := e.Manifest()
+		switch {
+		case was && !is:
+			out = append(out, Change{Kind: EpisodeInaccessible, Radio: r, Episode: e})
+		case !was && is:
+			out = append(out, Change{Kind: EpisodeAccessible, Radio: r, Episode: e})
+		}
+		if !prev.RequiresPremium() && e.RequiresPremium() {
+			out = append(out, Change{Kind: EpisodePremium, Radio: r, Episode: e})
+		}
+	}
+	for _, e := range old.Episodes() {
+		if !seen[e.Id()] {
+			out = append(out, Change{Kind: EpisodeRemoved, Radio: r, Episode: e})
+		}
+	}
+	return out
+}
+
+func joinHosts(r Radio) string {
+	ps := r.Hosts()
+	names := make([]string, len(ps))
+	for i, p := range ps {
+		names[i] = p.Name()
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,175 @@
+package onsen
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Represents the media file of a feed item.
+type Enclosure struct {
+	URL    string
+	Length int64
+	Type   string
+}
+
+type feed struct {
+	link      string
+	enclosure func(Episode) (Enclosure, bool)
+}
+
+type FeedOpt func(*feed)
+
+// Sets the link of the channel, defaults to the program page on onsen.ag.
+func WithFeedLink(link string) FeedOpt {
+	return func(f *feed) {
+		f.link = link
+	}
+}
+
+// Sets how an episode is enclosed, episodes without enclosure are left out of the feed. Defaults to
+// ManifestEnclosure.
+func WithEnclosure(fn func(Episode) (Enclosure, bool)) FeedOpt {
+	return func(f *feed) {
+		f.enclosure = fn
+	}
+}
+
+// Encloses the m3u8 manifest of an episode, episodes inaccessible with current session have no enclosure.
+func ManifestEnclosure(e Episode) (Enclosure, bool) {
+	u, _ := e.Manifest()
+	if u == "" {
+		return Enclosure{}, false
+	}
+	return Enclosure{URL: u, Type: "application/x-mpegURL"}, true
+}
+
+// Writes an RSS 2.0 feed with iTunes tags of the radio, episodes become items in the same order as Episodes().
+func Feed(w io.Writer, r Radio, opts ...FeedOpt) error {
+	f := &feed{
+		link:      "https://onsen.ag/program/" + r.Name(),
+		enclosure: ManifestEnclosure,
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	var hosts []string
+	for _, p := range r.Hosts() {
+		hosts = append(hosts, p.Name())
+	}
+
+	ch := rssChannel{
+		Title:       r.Title(),
+		Link:        f.link,
+		Description: r.Title(),
+		Language:    "ja",
+		Copyright:   r.Copyright(),
+		Author:      strings.Join(hosts, ", "),
+	}
+	if img := r.Image(); img != "" {
+		ch.Image = &rssImage{URL: img, Title: r.Title(), Link: f.link}
+		ch.ItunesImage = &itunesImage{Href: img}
+	}
+
+	for _, e := range r.Episodes() {
+		enc, ok := f.enclosure(e)
+		if !ok {
+			continue
+		}
+
+		it := rssItem{
+			Title:       e.Title(),
+			Description: feedDescription(e),
+			Guid:        rssGuid{Value: fmt.Sprintf("onsen-%d", e.Id())},
+			Enclosure:   rssEnclosure{URL: enc.URL, Length: enc.Length, Type: enc.Type},
+			EpisodeType: "full",
+		}
+		if tm, ok := e.JstUpdatedAt(); ok {
+			it.PubDate = tm.Format(time.RFC1123Z)
+		}
+		if e.IsBonus() {
+			it.EpisodeType = "bonus"
+		}
+		if p := e.Poster(); strings.HasPrefix(p, "http") {
+			it.ItunesImage = &itunesImage{Href: p}
+		}
+		ch.Items = append(ch.Items, it)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(rss{Version: "2.0", Itunes: "http://www.itunes.com/dtds/podcast-1.0.dtd", Channel: ch}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func feedDescription(e Episode) string {
+	gs := e.Guests()
+	if len(gs) == 0 {
+		return e.Title()
+	}
+
+	names := make([]string, len(gs))
+	for i, p := range gs {
+		names[i] = p.Name()
+	}
+	return e.Title() + " (Guests: " + strings.Join(names, ", ") + ")"
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Itunes  string     `xml:"xmlns:itunes,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string       `xml:"title"`
+	Link        string       `xml:"link"`
+	Description string       `xml:"description"`
+	Language    string       `xml:"language"`
+	Copyright   string       `xml:"copyright,omitempty"`
+	Image       *rssImage    `xml:"image,omitempty"`
+	Author      string       `xml:"itunes:author,omitempty"`
+	ItunesImage *itunesImage `xml:"itunes:image,omitempty"`
+	Items       []rssItem    `xml:"item"`
+}
+
+type rssImage struct {
+	URL   string `xml:"url"`
+	Title string `xml:"title"`
+	Link  string `xml:"link"`
+}
+
+type rssItem struct {
+	Title       string       `xml:"title"`
+	Description string       `xml:"description"`
+	Guid        rssGuid      `xml:"guid"`
+	PubDate     string       `xml:"pubDate,omitempty"`
+	Enclosure   rssEnclosure `xml:"enclosure"`
+	EpisodeType string       `xml:"itunes:episodeType"`
+	ItunesImage *itunesImage `xml:"itunes:image,omitempty"`
+}
+
+type rssGuid struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type itunesImage struct {
+	Href string `xml:"href,attr"`
+}
@@ -27,23 +27,80 @@ type State struct {
 
 // Represents the root.state.sign_in of a Nuxt JSON object. Decodes only the fields we want.
 type Signin struct {
-	Email                string `json:"email"`
-	Uid                  string `json:"uid"`
-	FavoritePerformerIds []int  `json:"favorite_performer_ids"`
-	FavoriteProgramIds   []int  `json:"favorite_program_ids"`
-	PlaylistedContentIds []int  `json:"playlisted_content_ids"`
+	Email                     string                 `json:"email"`
+	Uid                       string                 `json:"uid"`
+	FavoritePerformerIds      []int                  `json:"favorite_performer_ids"`
+	FavoritePerformerIdsOrder []int                  `json:"favorite_performer_ids_order"`
+	FavoriteProgramIds        []int                  `json:"favorite_program_ids"`
+	PlaylistedContentIds      []int                  `json:"playlisted_content_ids"`
+	SocialAccounts            map[string]interface{} `json:"social_accounts"`
+	// MM月DD日, nil for free users
+	SubscriptionEndsAt *string `json:"subscription_ends_at"`
+	// The platform subscribed from, e.g. "ios", nil for free users
+	Premium       *string        `json:"premium"`
+	UserListeneds []UserListened `json:"user_listeneds"`
+}
+
+// Represents the root.state.sign_in.user_listeneds[] of a Nuxt JSON object.
+type UserListened struct {
+	OngenId int `json:"ongen_id"`
+	// In seconds, -1 if it has been watched to the end
+	TimeStop int  `json:"time_stop"`
+	Watched  bool `json:"watched"`
 }
 
 // Represents the root.state.programs.programs.all[] of a Nuxt JSON object. Decodes only the fields we want.
 // If a radio series is got announced and it has no contents, as well as some special programs, they will have nil Updated.
 type Program struct {
-	Id            int         `json:"id"`
-	DirectoryName string      `json:"directory_name"`
-	Title         string      `json:"title"`
-	New           bool        `json:"new"`
-	Updated       *string     `json:"updated"`
-	Performers    []Performer `json:"performers"`
-	Contents      []Content   `json:"contents"`
+	Id                int              `json:"id"`
+	DirectoryName     string           `json:"directory_name"`
+	Display           bool             `json:"display"`
+	ShowContentsCount int              `json:"show_contents_count"`
+	Title             string           `json:"title"`
+	Image             Image            `json:"image"`
+	New               bool             `json:"new"`
+	List              bool             `json:"list"`
+	DeliveryInterval  *string          `json:"delivery_interval"`
+	DeliveryDayOfWeek []int            `json:"delivery_day_of_week"`
+	CategoryList      []string         `json:"category_list"`
+	Copyright         *string          `json:"copyright"`
+	SponsorName       *string          `json:"sponsor_name"`
+	Updated           *string          `json:"updated"`
+	Performers        []Performer      `json:"performers"`
+	RelatedLinks      []RelatedLink    `json:"related_links"`
+	RelatedInfos      []RelatedInfo    `json:"related_infos"`
+	RelatedPrograms   []RelatedProgram `json:"related_programs"`
+	Contents          []Content        `json:"contents"`
+}
+
+// Represents the root.state.programs.programs.all[].image, and contents[].tag_image of a Nuxt JSON object. Like
+// poster_image_url, Url is not always a string.
+type Image struct {
+	Url interface{} `json:"url"`
+}
+
+// Represents the root.state.programs.programs.all[].related_links[] of a Nuxt JSON object. Decodes all fields.
+type RelatedLink struct {
+	LinkUrl string `json:"link_url"`
+	Image   string `json:"image"`
+}
+
+// Represents the root.state.programs.programs.all[].related_infos[] of a Nuxt JSON object. Decodes all fields.
+// Category is one of "goods", "event" and "recommend".
+type RelatedInfo struct {
+	Category string `json:"category"`
+	LinkUrl  string `json:"link_url"`
+	Caption  string `json:"caption"`
+	Image    string `json:"image"`
+}
+
+// Represents the root.state.programs.programs.all[].related_programs[] of a Nuxt JSON object. Decodes only the
+// fields we want.
+type RelatedProgram struct {
+	Title         string `json:"title"`
+	DirectoryName string `json:"directory_name"`
+	Category      string `json:"category"`
+	Image         string `json:"image"`
 }
 
 // Represents the root.state.programs.programs.all[].performers of a Nuxt JSON object. Decodes all fields.
@@ -63,11 +120,14 @@ type Content struct {
 	MediaType      string      `json:"media_type"`
 	Premium        bool        `json:"premium"`
 	ProgramId      int         `json:"program_id"`
+	OngenId        int         `json:"ongen_id"`
 	DeliveryDate   interface{} `json:"delivery_date"`
 	Movie          bool        `json:"movie"`
 	PosterImageUrl interface{} `json:"poster_image_url"`
 	StreamingUrl   *string     `json:"streaming_url"`
+	TagImage       Image       `json:"tag_image"`
 	Guests         []Performer `json:"guests"`
+	Expiring       bool        `json:"expiring"`
 }
 
 func CreateFromReader(r io.Reader) (*Nuxt, error) {
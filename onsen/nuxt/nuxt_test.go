@@ -49,7 +49,21 @@ func TestCreateWithAnonymousUser(t *testing.T) {
 		{chosen.Id, 202},
 		{chosen.DirectoryName, "radionyan"},
 		{chosen.Title, "月とライカと吸血姫 ～アーニャ・シモニャン・ラジオニャン！～"},
+		{
+			chosen.Image.Url,
+			"https://d3bzklg4lms4gh.cloudfront.net/program_info/image/default/production" +
+				"/5b/6e/2a28979284885466f12fcc07f0a311736e29/image?v=1633683939",
+		},
 		{chosen.New, false},
+		{chosen.Display, true},
+		{chosen.List, true},
+		{chosen.ShowContentsCount, 10},
+		{chosen.DeliveryDayOfWeek, []int{5}},
+		{*chosen.DeliveryInterval, "隔週金曜配信19時配信"},
+		{chosen.CategoryList, []string{"new", "radio", "premium", "bonus", "anime"}},
+		{*chosen.Copyright, "© 牧野圭祐・小学館／「月とライカと吸血姫」製作委員会"},
+		{chosen.SponsorName, (*string)(nil)},
+		{len(chosen.RelatedPrograms), 0},
 		{*chosen.Updated, "10/22"},
 		{len(chosen.Contents), 6},
 		{
@@ -63,10 +77,10 @@ func TestCreateWithAnonymousUser(t *testing.T) {
 			Content{
 				6506, "第3回 おまけ",
 				true, false, true, "sound", true,
-				202, "10/22", false,
+				202, 6529, "10/22", false,
 				"https://d3bzklg4lms4gh.cloudfront.net/program_info/image/default/production" +
 					"/5b/6e/2a28979284885466f12fcc07f0a311736e29/image?v=1633683939",
-				nil, []Performer{},
+				nil, Image{nil}, []Performer{}, false,
 			},
 		},
 	}
@@ -102,6 +116,13 @@ func TestCreateWithLogined(t *testing.T) {
 		{len(chosen.Contents), 6},
 		// Preimum user can access this content
 		{*chosen.Contents[1].StreamingUrl, "HAS_BEEN_SCREENED"},
+		{*n.State.Signin.Premium, "ios"},
+		{*n.State.Signin.SubscriptionEndsAt, "11月15日"},
+		{n.State.Signin.FavoritePerformerIdsOrder[:3], []int{211, 396, 1544}},
+		{n.State.Signin.SocialAccounts["twitter"], nil},
+		{len(n.State.Signin.UserListeneds), 219},
+		{n.State.Signin.UserListeneds[0], UserListened{4831, 8, false}},
+		{n.State.Signin.UserListeneds[1], UserListened{5102, -1, true}},
 	}
 
 	for _, eq := range equals {
@@ -6,7 +6,9 @@
 //
 //    Radio.JstUpdatedAt()
 //    Episode.JstUpdatedAt()
+//    User.JstSubscriptionEndsAt()
 //    GuessJstTimeWithNow()
+//    ParseJstRelativeDateWithNow()
 //
 // Their outputs depend on time.Now(). (its year)
 //
@@ -21,8 +23,10 @@
 package onsen
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
+	"sort"
 	"strconv"
 	"time"
 
@@ -36,6 +40,10 @@ import (
 // Set this to a fixed time to test GuessJstTimeWithNow() and JstUpdatedAt().
 var guessRefTime = time.Now()
 
+// Returned when a session is given but the page is not signed in. onsen.ag serves the page of anonymous users for
+// sessions expired or invalid, so Nuxt.User() is the only way to tell.
+var ErrSessionExpired = errors.New("the session has expired or is invalid")
+
 // This function panics if it cannot parse the date string. date is a string in "YYYY-MM-DD" format.
 func SetRefDate(date string) {
 	tm, err := time.Parse("2006-01-02", date)
@@ -47,6 +55,7 @@ func SetRefDate(date string) {
 
 type RadioIndex map[interface{}]Radio
 type EpisodeIndex map[int]Episode
+type PersonIndex map[interface{}]Appearances
 
 type Onsen struct {
 	// Decorator for onsen's data
@@ -55,6 +64,9 @@ type Onsen struct {
 	cache struct {
 		r RadioIndex
 		e EpisodeIndex
+		// Indexed by ongen id
+		g EpisodeIndex
+		p PersonIndex
 	}
 }
 
@@ -78,6 +90,17 @@ func (o *Onsen) RadioIndex() RadioIndex {
 	return o.cache.r
 }
 
+// Returns the related radios of a radio, those no longer on the website are left out.
+func (o *Onsen) RelatedRadios(r Radio) []Radio {
+	out := []Radio{}
+	for _, name := range r.RelatedRadioNames() {
+		if related, ok := o.Radio(name); ok {
+			out = append(out, related)
+		}
+	}
+	return out
+}
+
 // Returns an Episode if found, otherwise ok is set to false.
 // The method creates a cache for all episodes when it is invoked for first time.
 func (o *Onsen) Episode(id int) (e Episode, ok bool) {
@@ -101,12 +124,173 @@ func (o *Onsen) EpisodeIndex() EpisodeIndex {
 	return o.cache.e
 }
 
+// Returns the appearances of a person if found, otherwise ok is set to false. Input can be either a person id or a
+// name. The method creates a cache for all people when it is invoked for first time.
+func (o *Onsen) Person(id interface{}) (a Appearances, ok bool) {
+	a, ok = o.PersonIndex()[id]
+	return
+}
+
+// Implements a simple person cache. We index Appearances by the id and the name of the person, the name points at
+// the one with the largest id if several people share it.
+func (o *Onsen) PersonIndex() PersonIndex {
+	if o.cache.p == nil {
+		var (
+			ids []int
+			as  = make(map[int]*Appearances)
+			of  = func(p Person) *Appearances {
+				a, ok := as[p.Id()]
+				if !ok {
+					a = &Appearances{Person: p, Hosted: []Radio{}, Guested: []Episode{}}
+					as[p.Id()] = a
+					ids = append(ids, p.Id())
+				}
+				return a
+			}
+		)
+		o.EachRadio(func(r Radio) {
+			for _, p := range r.Hosts() {
+				a := of(p)
+				a.Hosted = append(a.Hosted, r)
+			}
+			for _, e := range r.Episodes() {
+				for _, p := range e.Guests() {
+					a := of(p)
+					a.Guested = append(a.Guested, e)
+				}
+			}
+		})
+
+		sort.Ints(ids)
+		c := make(PersonIndex)
+		for _, id := range ids {
+			c[id] = *as[id]
+			c[as[id].Name()] = *as[id]
+		}
+		o.cache.p = c
+	}
+	return o.cache.p
+}
+
+// Returns episodes hosted or guested by any of the people, in ascending order on JstUpdatedAt(), the ones without
+// update time go first. Unknown people are ignored.
+func (o *Onsen) Featuring(ids ...int) []Episode {
+	var (
+		out  = []Episode{}
+		seen = make(map[int]bool)
+		add  = func(e Episode) {
+			if !seen[e.Id()] {
+				seen[e.Id()] = true
+				out = append(out, e)
+			}
+		}
+	)
+	for _, id := range ids {
+		a, ok := o.Person(id)
+		if !ok {
+			continue
+		}
+		for _, r := range a.Hosted {
+			for _, e := range r.Episodes() {
+				add(e)
+			}
+		}
+		for _, e := range a.Guested {
+			add(e)
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		a, _ := out[i].JstUpdatedAt()
+		b, _ := out[j].JstUpdatedAt()
+		return a.Before(b)
+	})
+	return out
+}
+
+// Returns an Episode by its ongen id if found, otherwise ok is set to false.
+// The method creates a cache for all episodes when it is invoked for first time.
+func (o *Onsen) EpisodeByOngenId(id int) (e Episode, ok bool) {
+	e, ok = o.OngenIndex()[id]
+	return
+}
+
+// Implements a simple episode cache by its ongen id, the id of the episode in the listen history. Episodes without
+// an ongen id are left out.
+func (o *Onsen) OngenIndex() EpisodeIndex {
+	if o.cache.g == nil {
+		c := make(EpisodeIndex)
+		o.EachRadio(func(r Radio) {
+			for _, e := range r.Episodes() {
+				if e.OngenId() == 0 {
+					continue
+				}
+				c[e.OngenId()] = e
+			}
+		})
+		o.cache.g = c
+	}
+	return o.cache.g
+}
+
+// Returns the listen history of the signed-in user in the same order as the website gives, episodes no longer on the
+// website are left out. Returns nil if there is no session associated.
+func (o *Onsen) History() []Listened {
+	u, ok := o.User()
+	if !ok {
+		return nil
+	}
+
+	out := []Listened{}
+	for i := range u.Raw.UserListeneds {
+		l := &u.Raw.UserListeneds[i]
+		if e, ok := o.EpisodeByOngenId(l.OngenId); ok {
+			out = append(out, Listened{Raw: l, Episode: e})
+		}
+	}
+	return out
+}
+
+// Returns episodes of the radios followed by the signed-in user which are not marked watched, in the order of
+// FollowingRadios() and then Episodes(). Returns nil if there is no session associated.
+func (o *Onsen) Unheard() []Episode {
+	u, ok := o.User()
+	if !ok {
+		return nil
+	}
+
+	watched := make(map[int]bool)
+	for _, l := range u.Raw.UserListeneds {
+		watched[l.OngenId] = watched[l.OngenId] || l.Watched
+	}
+
+	out := []Episode{}
+	for _, id := range u.FollowingRadios() {
+		r, ok := o.Radio(id)
+		if !ok {
+			continue
+		}
+		for _, e := range r.Episodes() {
+			if watched[e.OngenId()] {
+				continue
+			}
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
 // Takes a string of an index.html content from onsen.ag, returns an Onsen instance and any error encountered.
 func Create(html string) (*Onsen, error) {
 	raw, err := RawData(html)
 	if err != nil {
 		return nil, err
 	}
+	return CreateFromRawData(raw)
+}
+
+// Takes a JSON string of the raw data, as returned by RawData(), returns an Onsen instance and any error encountered.
+func CreateFromRawData(raw string) (*Onsen, error) {
 	n, err := nuxt.Create(raw)
 	if err != nil {
 		return nil, err
@@ -185,10 +369,110 @@ func (r Radio) Title() string {
 	return r.Raw.Title
 }
 
+// The URL to radio's program image, empty if there is none.
+func (r Radio) Image() string {
+	if url, ok := r.Raw.Image.Url.(string); ok {
+		return url
+	}
+	return ""
+}
+
+// Whether the radio is displayed on the website.
+func (r Radio) IsDisplayed() bool {
+	return r.Raw.Display
+}
+
+// Whether the radio is in the program list of the website.
+func (r Radio) IsListed() bool {
+	return r.Raw.List
+}
+
+// The number of episodes the website shows.
+func (r Radio) ShowContentsCount() int {
+	return r.Raw.ShowContentsCount
+}
+
+// Describes how often the radio is delivered, e.g.: 隔週金曜19時配信. Empty if unknown.
+func (r Radio) DeliveryInterval() string {
+	return stringOf(r.Raw.DeliveryInterval)
+}
+
+// Returns the weekdays the radio is delivered on. Both 0 and 7 are Sunday in the raw data.
+func (r Radio) Schedule() []time.Weekday {
+	out := make([]time.Weekday, len(r.Raw.DeliveryDayOfWeek))
+	for i, d := range r.Raw.DeliveryDayOfWeek {
+		out[i] = time.Weekday(d % 7)
+	}
+	return out
+}
+
+// Returns a new copy of non-nil slice, e.g.: ["movie", "premium"].
+func (r Radio) Categories() []string {
+	out := make([]string, len(r.Raw.CategoryList))
+	copy(out, r.Raw.CategoryList)
+	return out
+}
+
+func (r Radio) Copyright() string {
+	return stringOf(r.Raw.Copyright)
+}
+
+func (r Radio) Sponsor() string {
+	return stringOf(r.Raw.SponsorName)
+}
+
+// Returns a new copy of non-nil slice.
+func (r Radio) RelatedLinks() []RelatedLink {
+	out := make([]RelatedLink, len(r.Raw.RelatedLinks))
+	for i := range r.Raw.RelatedLinks {
+		out[i] = RelatedLink{&r.Raw.RelatedLinks[i]}
+	}
+	return out
+}
+
+// Returns a new copy of non-nil slice.
+func (r Radio) RelatedInfos() []RelatedInfo {
+	out := make([]RelatedInfo, len(r.Raw.RelatedInfos))
+	for i := range r.Raw.RelatedInfos {
+		out[i] = RelatedInfo{&r.Raw.RelatedInfos[i]}
+	}
+	return out
+}
+
+// Returns the related infos in "goods" category.
+func (r Radio) Goods() []RelatedInfo {
+	out := []RelatedInfo{}
+	for _, info := range r.RelatedInfos() {
+		if info.Category() == "goods" {
+			out = append(out, info)
+		}
+	}
+	return out
+}
+
+// Returns the names of related radios, use Onsen.RelatedRadios() to resolve them.
+func (r Radio) RelatedRadioNames() []string {
+	out := make([]string, len(r.Raw.RelatedPrograms))
+	for i, p := range r.Raw.RelatedPrograms {
+		out[i] = p.DirectoryName
+	}
+	return out
+}
+
 func (r Radio) HasBeenUpdated() bool {
 	return r.Raw.New
 }
 
+// Whether any episode of the radio is going to be removed from the website soon. Cheaper than Episodes() to walk.
+func (r Radio) IsExpiring() bool {
+	for _, c := range r.Raw.Contents {
+		if c.Expiring {
+			return true
+		}
+	}
+	return false
+}
+
 // SIDE EFFECT: this method has side effect, set a fixed year by SetRefDate() when testing its value.
 //
 // If a show is updated on "3/19", the method returns a time with its date set on either "2021/03/19" or "2020/03/19",
@@ -340,6 +624,11 @@ func (e Episode) RadioId() int {
 	return e.Raw.ProgramId
 }
 
+// The id of the audio/video source, listen histories of users refer episodes by this id.
+func (e Episode) OngenId() int {
+	return e.Raw.OngenId
+}
+
 func (e Episode) Title() string {
 	return e.Raw.Title
 }
@@ -412,6 +701,24 @@ func (e Episode) HasVideoStream() bool {
 	return e.Raw.Movie
 }
 
+// Either "sound" or "movie".
+func (e Episode) MediaType() string {
+	return e.Raw.MediaType
+}
+
+// The URL to episode's tag image, empty if there is none.
+func (e Episode) TagImage() string {
+	if url, ok := e.Raw.TagImage.Url.(string); ok {
+		return url
+	}
+	return ""
+}
+
+// Whether the episode is going to be removed from the website soon.
+func (e Episode) IsExpiring() bool {
+	return e.Raw.Expiring
+}
+
 // Transforms nuxt.Signin.
 type User struct {
 	Raw *nuxt.Signin
@@ -446,6 +753,122 @@ func (u User) PlaylistEpisodes() []int {
 	return out
 }
 
+// The order of FollowingPeople() as arranged by the user. Returns a new copy of non-nil slice.
+func (u User) FollowingPeopleOrder() []int {
+	out := make([]int, len(u.Raw.FavoritePerformerIdsOrder))
+	copy(out, u.Raw.FavoritePerformerIdsOrder)
+	return out
+}
+
+// Whether the user subscribes to the premium plan.
+func (u User) IsPremium() bool {
+	return u.Premium() != ""
+}
+
+// The platform which the user subscribes from, e.g. "ios", empty for free users.
+func (u User) Premium() string {
+	return stringOf(u.Raw.Premium)
+}
+
+// SIDE EFFECT: this method has side effect, set a fixed year by SetRefDate() when testing its value.
+//
+// The end of subscription in JST, the year is guessed to be the nearest one not going before the referenced time.
+// ok is false for free users.
+func (u User) JstSubscriptionEndsAt() (tm time.Time, ok bool) {
+	re := regexp.MustCompile("^([0-9]{1,2})月([0-9]{1,2})日$")
+
+	m := re.FindStringSubmatch(stringOf(u.Raw.SubscriptionEndsAt))
+	if m == nil {
+		return time.Time{}, false
+	}
+
+	tm, ok = GuessJstTimeWithNow(m[1] + "/" + m[2])
+	if !ok {
+		return time.Time{}, false
+	}
+
+	ref := guessRefTime.In(tm.Location())
+	if y, m, d := ref.Date(); tm.Before(time.Date(y, m, d, 0, 0, 0, 0, tm.Location())) {
+		tm = tm.AddDate(1, 0, 0)
+	}
+	return tm, true
+}
+
+// Names of linked social accounts in ascending order, e.g. "twitter".
+func (u User) SocialAccounts() []string {
+	out := []string{}
+	for name, v := range u.Raw.SocialAccounts {
+		if v != nil {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Transforms nuxt.UserListened, joined to the episode listened.
+type Listened struct {
+	Raw     *nuxt.UserListened
+	Episode Episode
+}
+
+// Whether the episode is marked watched.
+func (l Listened) IsWatched() bool {
+	return l.Raw.Watched
+}
+
+// Where the user stopped listening to resume from, zero if it has been watched to the end.
+func (l Listened) Position() time.Duration {
+	if l.Raw.TimeStop < 0 {
+		return 0
+	}
+	return time.Duration(l.Raw.TimeStop) * time.Second
+}
+
+// Transforms nuxt.RelatedLink.
+type RelatedLink struct {
+	Raw *nuxt.RelatedLink
+}
+
+func (l RelatedLink) URL() string {
+	return l.Raw.LinkUrl
+}
+
+func (l RelatedLink) Image() string {
+	return l.Raw.Image
+}
+
+// Transforms nuxt.RelatedInfo.
+type RelatedInfo struct {
+	Raw *nuxt.RelatedInfo
+}
+
+// One of "goods", "event" and "recommend".
+func (i RelatedInfo) Category() string {
+	return i.Raw.Category
+}
+
+func (i RelatedInfo) URL() string {
+	return i.Raw.LinkUrl
+}
+
+func (i RelatedInfo) Caption() string {
+	return i.Raw.Caption
+}
+
+func (i RelatedInfo) Image() string {
+	return i.Raw.Image
+}
+
+// A person and where the person appears on the website.
+type Appearances struct {
+	Person
+	// Radios hosted, in the same order as Radios()
+	Hosted []Radio
+	// Episodes guested, in the same order as Radios() and then Episodes()
+	Guested []Episode
+}
+
 // Transforms nuxt.Performer.
 type Person struct {
 	Raw *nuxt.Performer
@@ -532,3 +955,10 @@ func GuessJstTimeWithNow(guess string) (res time.Time, ok bool) {
 
 	return GuessTime(guess, ref)
 }
+
+func stringOf(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -1,7 +1,10 @@
 package onsen
 
 import (
+	"encoding/xml"
+	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -129,7 +132,13 @@ func TestNuxtWithAnonymousUser(t *testing.T) {
 		{k.Id(), 202},
 		{k.Name(), "radionyan"},
 		{k.Title(), "月とライカと吸血姫 ～アーニャ・シモニャン・ラジオニャン！～"},
+		{
+			k.Image(),
+			"https://d3bzklg4lms4gh.cloudfront.net/program_info/image/default/production" +
+				"/5b/6e/2a28979284885466f12fcc07f0a311736e29/image?v=1633683939",
+		},
 		{k.HasBeenUpdated(), false},
+		{k.IsExpiring(), false},
 		{len(k.Hosts()), 1},
 		{k.Hosts()[0].Id(), 1189},
 		{k.Hosts()[0].Name(), "木野日菜"},
@@ -152,6 +161,10 @@ func TestNuxtWithAnonymousUser(t *testing.T) {
 		{k.Episodes()[4].IsLatest(), false},
 		{k.Episodes()[4].RequiresPremium(), true},
 		{k.Episodes()[4].HasVideoStream(), false},
+		{k.Episodes()[4].OngenId(), 6029},
+		{k.Episodes()[4].MediaType(), "sound"},
+		{k.Episodes()[4].TagImage(), ""},
+		{k.Episodes()[4].IsExpiring(), false},
 	}
 	for _, eq := range eqs {
 		assert.Equal(eq.out, eq.in)
@@ -178,6 +191,51 @@ func TestNuxtWithAnonymousUser(t *testing.T) {
 		// fujita: has videos
 		f := n.Radios()[9]
 		assert.True(f.Episodes()[0].HasVideoStream())
+		assert.Equal("movie", f.Episodes()[0].MediaType())
+	}
+	{
+		// Tag images
+		e := n.Radios()[43].Episodes()[0]
+		assert.Equal(
+			"https://d3bzklg4lms4gh.cloudfront.net/content_version/image/default/production"+
+				"/9a/9a/825a235a56d7249cc4162bee43c129f8a3ce/image?v=1629957954",
+			e.TagImage(),
+		)
+	}
+	{
+		// fujita: program metadata
+		f := n.Radios()[9]
+		assert.True(f.IsDisplayed())
+		assert.True(f.IsListed())
+		assert.Equal(10, f.ShowContentsCount())
+		assert.Equal("隔週金曜19時配信（過去アーカイブ9回）", f.DeliveryInterval())
+		assert.Equal([]time.Weekday{time.Friday}, f.Schedule())
+		assert.Equal([]string{"movie", "premium"}, f.Categories())
+		assert.Equal("©Internet Radio Station＜音泉＞", f.Copyright())
+		assert.Equal("タブリエ・コミュニケーションズ", f.Sponsor())
+		assert.Empty(f.RelatedLinks())
+		assert.Len(f.RelatedInfos(), 4)
+		assert.Len(f.Goods(), 4)
+		assert.Equal("https://www.otomart.jp/SHOP/GOODS-0834.html", f.Goods()[0].URL())
+		assert.Equal("藤田茜シーズン１Tシャツその3", f.Goods()[0].Caption())
+		assert.Equal("goods", f.Goods()[0].Category())
+		assert.Contains(f.Goods()[0].Image(), "/related_info/image/")
+		assert.Equal([]string{"gurepa", "gurepap", "anaradi"}, f.RelatedRadioNames())
+	}
+	{
+		// oddtaxi: related links
+		l := n.Radios()[1].RelatedLinks()
+		assert.Equal("https://oddtaxi.jp/", l[0].URL())
+		assert.Contains(l[0].Image(), "/related_link/image/")
+	}
+	{
+		// seikowa_otsuge: delivered everyday except Sunday
+		for _, r := range n.Radios() {
+			if r.Name() == "seikowa_otsuge" {
+				assert.Len(r.Schedule(), 6)
+				assert.Equal(time.Monday, r.Schedule()[0])
+			}
+		}
 	}
 }
 
@@ -218,6 +276,10 @@ func TestNuxtWithPremiumUser(t *testing.T) {
 				6525, 6527, 6528, 6582, 6600, 6601, 6594, 6609, 6610,
 			},
 		},
+		{u.FollowingPeopleOrder()[:3], []int{211, 396, 1544}},
+		{u.IsPremium(), true},
+		{u.Premium(), "ios"},
+		{u.SocialAccounts(), []string{}},
 	}
 	for _, eq := range eqs {
 		assert.Equal(eq.out, eq.in)
@@ -233,6 +295,85 @@ func TestNuxtWithPremiumUser(t *testing.T) {
 	}
 }
 
+func TestUserJstSubscriptionEndsAt(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		f, _   = os.ReadFile("testdata/fixture_paid_screened.json")
+		str, _ = nuxt.Create(string(f))
+		u, _   = Nuxt{str}.User()
+		loc    = time.FixedZone("UTC+9", 9*60*60)
+	)
+	defer SetRefDate("2021-10-29")
+
+	{
+		tm, ok := u.JstSubscriptionEndsAt()
+		assert.True(ok)
+		assert.Equal(time.Date(2021, 11, 15, 0, 0, 0, 0, loc), tm)
+	}
+	{
+		SetRefDate("2021-11-16")
+		tm, _ := u.JstSubscriptionEndsAt()
+		assert.Equal(time.Date(2022, 11, 15, 0, 0, 0, 0, loc), tm)
+	}
+	{
+		u.Raw.SubscriptionEndsAt = nil
+		_, ok := u.JstSubscriptionEndsAt()
+		assert.False(ok)
+	}
+}
+
+func TestOnsenHistory(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		f, _   = os.ReadFile("testdata/fixture_paid_screened.json")
+		str, _ = nuxt.Create(string(f))
+		o      = &Onsen{Nuxt: Nuxt{str}}
+	)
+
+	e, ok := o.EpisodeByOngenId(5189)
+	assert.True(ok)
+	assert.Equal(5166, e.Id())
+
+	{
+		// Episodes without an ongen id are not indexed
+		o := &Onsen{Nuxt: Nuxt{str}}
+		r, _ := o.Radio("fate-apocrypha")
+		id := r.Raw.Contents[0].OngenId
+		r.Raw.Contents[0].OngenId = 0
+		_, ok := o.EpisodeByOngenId(0)
+		assert.False(ok)
+		assert.Len(o.OngenIndex(), len(o.EpisodeIndex())-1)
+		r.Raw.Contents[0].OngenId = id
+	}
+
+	hs := o.History()
+	assert.Len(hs, 206)
+	assert.Equal(5028, hs[0].Episode.Id())
+	assert.True(hs[0].IsWatched())
+	assert.Equal(time.Duration(0), hs[0].Position())
+
+	var unwatched []Listened
+	for _, l := range hs {
+		if !l.IsWatched() {
+			unwatched = append(unwatched, l)
+		}
+	}
+	assert.Len(unwatched, 2)
+	assert.Equal(5166, unwatched[0].Episode.Id())
+	assert.Equal(2267*time.Second, unwatched[0].Position())
+
+	us := o.Unheard()
+	assert.Len(us, 137)
+	assert.Equal(6621, us[0].Id())
+
+	{
+		f, _ := os.ReadFile("testdata/fixture_nologin_screened.html")
+		o, _ := Create(string(f))
+		assert.Nil(o.History())
+		assert.Nil(o.Unheard())
+	}
+}
+
 func TestCreate(t *testing.T) {
 	assert := assert.New(t)
 	{
@@ -279,6 +420,22 @@ func TestOnsenRadio(t *testing.T) {
 	}
 }
 
+func TestOnsenRelatedRadios(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		f, _   = os.ReadFile("testdata/fixture_nologin_screened.html")
+		o, _   = Create(string(f))
+		r, _   = o.Radio("fujita")
+	)
+
+	rs := o.RelatedRadios(r)
+	assert.Len(rs, 3)
+	assert.Equal("鷲崎健・藤田茜のグレパラジオP", rs[1].Title())
+
+	r.Raw.RelatedPrograms[0].DirectoryName = "nosuchradio"
+	assert.Len(o.RelatedRadios(r), 2)
+}
+
 func TestOnsenEpisode(t *testing.T) {
 	var (
 		assert = assert.New(t)
@@ -302,3 +459,287 @@ func TestOnsenEpisode(t *testing.T) {
 		assert.NotNil(o.cache.e)
 	}
 }
+
+func TestFeed(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		f, _   = os.ReadFile("testdata/fixture_nologin_screened.html")
+		o, _   = Create(string(f))
+		r, _   = o.Radio("radionyan")
+	)
+
+	{
+		var b strings.Builder
+		assert.NoError(Feed(&b, r))
+
+		out := b.String()
+		assert.True(strings.HasPrefix(out, xml.Header+`<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">`))
+		assert.Contains(out, "<title>月とライカと吸血姫 ～アーニャ・シモニャン・ラジオニャン！～</title>")
+		assert.Contains(out, "<link>https://onsen.ag/program/radionyan</link>")
+		assert.Contains(out, "<copyright>© 牧野圭祐・小学館／「月とライカと吸血姫」製作委員会</copyright>")
+		assert.Contains(out, "<itunes:author>木野日菜</itunes:author>")
+		assert.Contains(out, `<itunes:image href="`+r.Image()+`"></itunes:image>`)
+		// Only the accessible one
+		assert.Equal(1, strings.Count(out, "<item>"))
+		assert.Contains(out, "<description>第3回 (Guests: 宝野アリカ)</description>")
+		assert.Contains(out, `<guid isPermaLink="false">onsen-6505</guid>`)
+		assert.Contains(out, "<pubDate>Fri, 22 Oct 2021 00:00:00 +0900</pubDate>")
+		assert.Contains(out, `<enclosure url="HAS_BEEN_SCREENED" length="0" type="application/x-mpegURL"></enclosure>`)
+		assert.NoError(xml.Unmarshal([]byte(out), new(struct{})))
+	}
+	{
+		var b strings.Builder
+		assert.NoError(Feed(
+			&b, r,
+			WithFeedLink("http://localhost/"),
+			WithEnclosure(func(e Episode) (Enclosure, bool) {
+				return Enclosure{URL: fmt.Sprintf("http://localhost/%d.m4a", e.Id()), Length: 5, Type: "audio/mp4"}, true
+			}),
+		))
+
+		out := b.String()
+		assert.Contains(out, "<link>http://localhost/</link>")
+		assert.Equal(6, strings.Count(out, "<item>"))
+		assert.Contains(out, `<enclosure url="http://localhost/6506.m4a" length="5" type="audio/mp4"></enclosure>`)
+		assert.Contains(out, "<itunes:episodeType>bonus</itunes:episodeType>")
+	}
+}
+
+func TestOnsenPerson(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		f, _   = os.ReadFile("testdata/fixture_nologin_screened.html")
+		o, _   = Create(string(f))
+	)
+
+	assert.Nil(o.cache.p)
+	_, ok := o.Person(-1)
+	assert.False(ok)
+	assert.NotNil(o.cache.p)
+
+	a, ok := o.Person(338)
+	assert.True(ok)
+	assert.Equal("小林裕介", a.Name())
+	assert.Len(a.Hosted, 4)
+	assert.Equal("taisho-otome", a.Hosted[0].Name())
+	assert.Len(a.Guested, 3)
+	assert.Equal(3758, a.Guested[0].Id())
+
+	b, ok := o.Person("小林裕介")
+	assert.True(ok)
+	assert.Equal(a, b)
+
+	// 342 people, indexed by both ids and names, one name is shared by two people
+	assert.Len(o.PersonIndex(), 342*2-1)
+}
+
+func TestOnsenFeaturing(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		f, _   = os.ReadFile("testdata/fixture_nologin_screened.html")
+		o, _   = Create(string(f))
+	)
+
+	assert.Empty(o.Featuring())
+	assert.Empty(o.Featuring(-1))
+
+	// 小林裕介 hosts 4 radios and guests in 3 episodes
+	es := o.Featuring(338)
+	a, _ := o.Person(338)
+	n := len(a.Guested)
+	for _, r := range a.Hosted {
+		n += len(r.Episodes())
+	}
+	assert.Len(es, n)
+	for i := 1; i < len(es); i++ {
+		prev, _ := es[i-1].JstUpdatedAt()
+		tm, _ := es[i].JstUpdatedAt()
+		assert.False(tm.Before(prev))
+	}
+
+	// Shared episodes are listed once
+	assert.Len(o.Featuring(338, 338), n)
+}
+
+func TestNormalize(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("グレパラジオ", Normalize("ｸﾞﾚﾊﾟﾗｼﾞｵ"))
+	assert.Equal("リゼロ", Normalize("りぜろ"))
+	assert.Equal("re:ゼロ 1", Normalize("ＲＥ：ゼロ　１"))
+	assert.Equal("藤田茜", Normalize("藤田茜"))
+}
+
+func TestOnsenSearch(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		f, _   = os.ReadFile("testdata/fixture_nologin_screened.html")
+		o, _   = Create(string(f))
+	)
+
+	assert.Empty(o.Search(" "))
+	assert.Empty(o.Search("nosuchradio"))
+
+	{
+		// Exact radio title and person name go first, radios on tie
+		ms := o.Search("藤田")
+		assert.Len(ms, 8)
+		assert.Equal(KindRadio, ms[0].Kind)
+		assert.Equal("fujita", ms[0].Radio.Name())
+		assert.Equal(KindPerson, ms[1].Kind)
+		assert.Equal("藤田茜", ms[1].Person.Name())
+		// Hosted by 藤田茜
+		assert.Equal("gurepa", ms[2].Radio.Name())
+	}
+	{
+		// Folded widths and kana
+		ms := o.Search("ｸﾞﾚﾊﾟﾗ")
+		assert.Len(ms, 2)
+		assert.Equal(ms, o.Search("ぐれぱら"))
+	}
+	{
+		// Episodes matching their radios as well
+		ms := o.Search("fujita 予告")
+		assert.Len(ms, 10)
+		assert.Equal(KindEpisode, ms[0].Kind)
+		assert.Equal("fujita", ms[0].Radio.Name())
+		assert.Equal("第88回 予告", ms[0].Episode.Title())
+		// But not on radios only
+		assert.Len(o.Search("fujita"), 1)
+	}
+	{
+		// Letters in order
+		ms := o.Search("fjta")
+		assert.Len(ms, 1)
+		assert.Equal("fujita", ms[0].Radio.Name())
+		assert.Empty(o.Search("ふじた"))
+	}
+}
+
+func TestParseWeekday(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, s := range []string{"fri", "Friday", "金", "金曜", "金曜日"} {
+		d, err := ParseWeekday(s)
+		assert.NoError(err, s)
+		assert.Equal(time.Friday, d, s)
+	}
+	for _, s := range []string{"日", "日曜日", "sun"} {
+		d, err := ParseWeekday(s)
+		assert.NoError(err, s)
+		assert.Equal(time.Sunday, d, s)
+	}
+	_, err := ParseWeekday("someday")
+	assert.EqualError(err, `ParseWeekday: unknown weekday "someday"`)
+}
+
+func TestParseJstRelativeDate(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		loc    = time.FixedZone("UTC+9", 9*60*60)
+		date   = func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, loc) }
+		// Friday in JST
+		ref = time.Date(2021, 10, 29, 1, 0, 0, 0, time.UTC)
+	)
+
+	tests := []struct {
+		in       string
+		expected time.Time
+	}{
+		{"2021-04-01", date(2021, 4, 1)},
+		{"today", date(2021, 10, 29)},
+		{"Yesterday", date(2021, 10, 28)},
+		{"7d", date(2021, 10, 22)},
+		{"2w", date(2021, 10, 15)},
+		{"0d", date(2021, 10, 29)},
+		{"last-friday", date(2021, 10, 22)},
+		{"last-sat", date(2021, 10, 23)},
+		{"last-木", date(2021, 10, 28)},
+	}
+	for _, test := range tests {
+		tm, err := ParseJstRelativeDate(test.in, ref)
+		assert.NoError(err, test.in)
+		assert.True(test.expected.Equal(tm), "%s: %v", test.in, tm)
+	}
+
+	_, err := ParseJstRelativeDate("last-someday", ref)
+	assert.Error(err)
+	_, err = ParseJstRelativeDate("4/1", ref)
+	assert.EqualError(err, `ParseJstRelativeDate: "4/1" must be YYYY-MM-DD, today, yesterday, 7d, 2w or last-friday`)
+
+	// 2021-10-29 by TestMain
+	tm, _ := ParseJstRelativeDateWithNow("1d")
+	assert.True(date(2021, 10, 28).Equal(tm))
+}
+
+func TestRadioIsDeliveredOn(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		f, _   = os.ReadFile("testdata/fixture_nologin_screened.html")
+		o, _   = Create(string(f))
+		r, _   = o.Radio("fujita")
+	)
+
+	assert.True(r.IsDeliveredOn(time.Friday))
+	assert.False(r.IsDeliveredOn(time.Monday))
+	assert.True(JstDate(time.Date(2021, 10, 28, 16, 0, 0, 0, time.UTC)).Equal(time.Date(2021, 10, 29, 0, 0, 0, 0, time.FixedZone("", 9*60*60))))
+}
+
+func TestDiff(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		f, _   = os.ReadFile("testdata/fixture_nologin_screened.json")
+		a, _   = CreateFromRawData(string(f))
+		b, _   = CreateFromRawData(string(f))
+	)
+
+	{
+		a, _ := CreateFromRawData(string(f))
+		b, _ := CreateFromRawData(string(f))
+		assert.Empty(Diff(a, b))
+	}
+
+	// Removed from a, hence added to b
+	ra := a.Raw.State.Programs.Programs.All
+	ra[5].Contents = ra[5].Contents[1:]
+	ra[7].Contents[0].StreamingUrl = nil
+	a.Raw.State.Programs.Programs.All = append(ra[:6:6], ra[7:]...)
+
+	rb := b.Raw.State.Programs.Programs.All
+	title, episodeTitle := rb[0].Title, rb[4].Contents[1].Title
+	rb[0].Title = "新しいタイトル"
+	rb[1].Performers = rb[1].Performers[:1]
+	rb[2].Contents = rb[2].Contents[1:]
+	rb[3].Contents[0].StreamingUrl = nil
+	rb[4].Contents[0].Premium = true
+	rb[4].Contents[1].Title = "第1回"
+	b.Raw.State.Programs.Programs.All = append(rb[:9:9], rb[10:]...)
+
+	type c struct {
+		kind    string
+		radio   string
+		episode int
+		old     string
+		new     string
+	}
+	var out []c
+	for _, ch := range Diff(a, b) {
+		id := 0
+		if ch.Episode.Raw != nil {
+			id = ch.Episode.Id()
+		}
+		out = append(out, c{ch.Kind, ch.Radio.Name(), id, ch.Old, ch.New})
+	}
+	assert.Equal([]c{
+		{TitleChanged, "shigohaji", 0, title, "新しいタイトル"},
+		{HostsChanged, "oddtaxi", 0, "伊藤裕史, 平賀大介", "伊藤裕史"},
+		{EpisodeRemoved, "yyy", 6595, "", ""},
+		{EpisodeInaccessible, "gashitai", 6587, "", ""},
+		{EpisodePremium, "nownew", 6591, "", ""},
+		{TitleChanged, "nownew", 6592, episodeTitle, "第1回"},
+		{EpisodeAdded, "soreradi", 6562, "", ""},
+		{RadioAdded, "taisho-otome", 0, "", ""},
+		{EpisodeAccessible, "radionyan", 6505, "", ""},
+		{RadioRemoved, "fujita", 0, "", ""},
+	}, out)
+}
@@ -0,0 +1,185 @@
+package onsen
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Kinds of search results, in the order they are ranked on a tie.
+const (
+	KindRadio   = "radio"
+	KindPerson  = "person"
+	KindEpisode = "episode"
+)
+
+// A search result. Radio is set for radios and episodes, Episode for episodes and Person for people.
+type Match struct {
+	Kind    string
+	Score   int
+	Radio   Radio
+	Episode Episode
+	Person  Person
+}
+
+// A searchable field of a result and its weight.
+type field struct {
+	text   string
+	weight int
+	// Whether the field belongs to the result itself, e.g. the radio title of an episode does not.
+	own bool
+}
+
+// Returns radios, episodes and people matching every word of the query, ranked in descending order on the score.
+//
+// Radios match on names, titles and hosts, episodes on titles and guests, and people on names. An episode also
+// matches on the name and the title of its radio, as long as at least one word matches the episode itself. Both the
+// query and the fields are compared after Normalize(), a word scores the most if it equals a field, less if it
+// prefixes or is contained in one, and the least if its letters appear in order in one. The last applies only to
+// ASCII words of 3 letters or more, e.g. "grpp" matches "gurepap", as Japanese words in order are mostly unrelated.
+func (o *Onsen) Search(query string) []Match {
+	words := strings.Fields(Normalize(query))
+	if len(words) == 0 {
+		return []Match{}
+	}
+
+	var (
+		out = []Match{}
+		add = func(m Match, fs []field) {
+			if m.Score = score(words, fs); m.Score > 0 {
+				out = append(out, m)
+			}
+		}
+	)
+	o.EachRadio(func(r Radio) {
+		rfs := []field{
+			{Normalize(r.Name()), 3, true},
+			{Normalize(r.Title()), 3, true},
+		}
+		for _, p := range r.Hosts() {
+			rfs = append(rfs, field{Normalize(p.Name()), 2, true})
+		}
+		add(Match{Kind: KindRadio, Radio: r}, rfs)
+
+		for _, e := range r.Episodes() {
+			efs := []field{
+				{Normalize(e.Title()), 2, true},
+				{rfs[0].text, 1, false},
+				{rfs[1].text, 1, false},
+			}
+			for _, p := range e.Guests() {
+				efs = append(efs, field{Normalize(p.Name()), 2, true})
+			}
+			add(Match{Kind: KindEpisode, Radio: r, Episode: e}, efs)
+		}
+	})
+	for k, a := range o.PersonIndex() {
+		if _, ok := k.(int); ok {
+			add(Match{Kind: KindPerson, Person: a.Person}, []field{{Normalize(a.Name()), 3, true}})
+		}
+	}
+
+	rank := map[string]int{KindRadio: 0, KindPerson: 1, KindEpisode: 2}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		switch {
+		case a.Score != b.Score:
+			return a.Score > b.Score
+		case a.Kind != b.Kind:
+			return rank[a.Kind] < rank[b.Kind]
+		}
+		return a.id() < b.id()
+	})
+	return out
+}
+
+func (m Match) id() int {
+	switch m.Kind {
+	case KindRadio:
+		return m.Radio.Id()
+	case KindEpisode:
+		return m.Episode.Id()
+	}
+	return m.Person.Id()
+}
+
+// Sums the best score of every word among the fields, zero if any word matches nothing or no word matches an own
+// field.
+func score(words []string, fs []field) int {
+	var (
+		total int
+		own   bool
+	)
+	for _, w := range words {
+		var best int
+		for _, f := range fs {
+			s := f.weight * matchWord(w, f.text)
+			if s > 0 && f.own {
+				own = true
+			}
+			if s > best {
+				best = s
+			}
+		}
+		if best == 0 {
+			return 0
+		}
+		total += best
+	}
+	if !own {
+		return 0
+	}
+	return total
+}
+
+func matchWord(w, text string) int {
+	switch {
+	case text == w:
+		return 10
+	case strings.HasPrefix(text, w):
+		return 6
+	case strings.Contains(text, w):
+		return 4
+	case len(w) >= 3 && isASCII(w) && subsequence(w, text):
+		return 1
+	}
+	return 0
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// Whether the runes of w appear in text in order.
+func subsequence(w, text string) bool {
+	rs := []rune(w)
+	for _, r := range text {
+		if len(rs) == 0 {
+			break
+		}
+		if r == rs[0] {
+			rs = rs[1:]
+		}
+	}
+	return len(rs) == 0
+}
+
+// Folds a string for searching: full-width alphanumerics and half-width katakana are unified by NFKC, hiragana
+// becomes katakana, and letters become lower case.
+func Normalize(s string) string {
+	return strings.Map(func(r rune) rune {
+		// ぁ..ゖ, ゝ and ゞ are 0x60 away from their katakana
+		if (r >= 'ぁ' && r <= 'ゖ') || r == 'ゝ' || r == 'ゞ' {
+			return r + 0x60
+		}
+		return unicode.ToLower(r)
+	}, norm.NFKC.String(s))
+}
@@ -2,13 +2,19 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"os"
 
 	"github.com/adios/onsengo/cmd"
+	"github.com/adios/onsengo/onsen"
 )
 
 func main() {
 	if err := cmd.Execute(); err != nil {
-		os.Exit(1)
+		if errors.Is(err, onsen.ErrSessionExpired) {
+			fmt.Fprintln(os.Stderr, "Log in again by the login command, or renew --session or --cookies.")
+		}
+		os.Exit(cmd.ExitCode(err))
 	}
 }
@@ -0,0 +1,126 @@
+package remux
+
+import (
+	"fmt"
+)
+
+// Sampling frequencies indexed by the sampling_frequency_index of ADTS.
+var adtsFrequencies = []int{
+	96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350,
+}
+
+// Represents an AAC track taken from ADTS frames.
+type aacTrack struct {
+	// AudioSpecificConfig for esds
+	config     []byte
+	sampleRate int
+	channels   int
+	frames     int
+
+	// Receives each frame without the ADTS header
+	frame func([]byte) error
+	// An incomplete frame or tag, waiting for the rest
+	buf []byte
+	// Bytes skipped since the last frame
+	skipped int
+}
+
+// Parses consecutive ADTS frames, which can be written in pieces split anywhere. ID3 tags in between, as those at the
+// beginning of the packed audio segments, are skipped.
+func (t *aacTrack) write(b []byte) error {
+	t.buf = append(t.buf, b...)
+	b = t.buf
+
+	for len(b) > 0 {
+		if len(b) >= 3 && string(b[:3]) == "ID3" {
+			n, ok := id3Size(b)
+			if !ok || n > len(b) {
+				break
+			}
+			b = b[n:]
+			continue
+		}
+
+		if len(b) < 7 {
+			break
+		}
+		if b[0] != 0xff || b[1]&0xf0 != 0xf0 {
+			// Resync on garbage
+			b = b[1:]
+			t.skipped++
+			continue
+		}
+
+		var (
+			protectionAbsent = b[1]&0x01 != 0
+			profile          = int(b[2] >> 6)
+			freqIndex        = int(b[2] >> 2 & 0x0f)
+			channels         = int(b[2]&0x01)<<2 | int(b[3]>>6)
+			length           = int(b[3]&0x03)<<11 | int(b[4])<<3 | int(b[5]>>5)
+			header           = 7
+		)
+		if !protectionAbsent {
+			header = 9
+		}
+		if length < header {
+			// A corrupted header, or a syncword by chance
+			b = b[1:]
+			t.skipped++
+			continue
+		}
+		if length > len(b) {
+			break
+		}
+		if freqIndex >= len(adtsFrequencies) {
+			return fmt.Errorf("Remux: invalid ADTS sampling frequency index %d", freqIndex)
+		}
+
+		if t.config == nil {
+			objectType := profile + 1
+			t.config = []byte{
+				byte(objectType<<3 | freqIndex>>1),
+				byte((freqIndex&0x01)<<7 | channels<<3),
+			}
+			t.sampleRate = adtsFrequencies[freqIndex]
+			t.channels = channels
+		}
+
+		if err := t.frame(b[header:length]); err != nil {
+			return err
+		}
+		t.frames++
+		t.skipped = 0
+		b = b[length:]
+	}
+
+	t.buf = t.buf[:copy(t.buf, b)]
+	return nil
+}
+
+// Ends the track, the rest of an incomplete frame is dropped. Garbage at the end, where no frame is found again,
+// fails the track rather than truncating it silently.
+func (t *aacTrack) close() error {
+	rest := len(t.buf)
+	t.buf = nil
+	if t.frames == 0 {
+		return fmt.Errorf("Remux: no ADTS frames")
+	}
+	if t.skipped > 0 {
+		return fmt.Errorf("Remux: lost ADTS sync, no frame in the last %d bytes", t.skipped+rest)
+	}
+	return nil
+}
+
+// Returns the size of the ID3v2 tag at the beginning of b.
+func id3Size(b []byte) (int, bool) {
+	if len(b) < 10 || string(b[:3]) != "ID3" {
+		return 0, false
+	}
+	// Syncsafe integer
+	n := int(b[6]&0x7f)<<21 | int(b[7]&0x7f)<<14 | int(b[8]&0x7f)<<7 | int(b[9]&0x7f)
+	if b[5]&0x10 != 0 {
+		// Footer present
+		n += 10
+	}
+	return 10 + n, true
+}
@@ -0,0 +1,273 @@
+package remux
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	nalIDR = 5
+	nalSPS = 7
+	nalPPS = 8
+	nalAUD = 9
+)
+
+// Represents a H.264 track taken from the access units of PES packets.
+type avcTrack struct {
+	sps, pps      []byte
+	width, height int
+	samples       []avcSample
+
+	// Receives the data of each sample, NAL units prefixed by 4-byte lengths
+	sample func([]byte) error
+	// The data of the last sample, which may continue in the next PES packets
+	pending []byte
+}
+
+type avcSample struct {
+	pts, dts int64
+	key      bool
+}
+
+// Converts the access unit of a PES packet into a sample. Parameter sets are moved out of the samples into avcC.
+func (t *avcTrack) write(p pes) error {
+	var (
+		s   = avcSample{pts: p.pts, dts: p.dts}
+		buf []byte
+	)
+	for _, nal := range splitNALUnits(p.payload) {
+		switch nal[0] & 0x1f {
+		case nalSPS:
+			if t.sps == nil {
+				t.sps = append([]byte(nil), nal...)
+			}
+			continue
+		case nalPPS:
+			if t.pps == nil {
+				t.pps = append([]byte(nil), nal...)
+			}
+			continue
+		case nalAUD:
+			continue
+		case nalIDR:
+			s.key = true
+		}
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(nal)))
+		buf = append(buf, nal...)
+	}
+	if len(buf) == 0 {
+		return nil
+	}
+	if !p.timed && len(t.samples) > 0 {
+		// Continuation of the previous access unit
+		last := &t.samples[len(t.samples)-1]
+		last.key = last.key || s.key
+		t.pending = append(t.pending, buf...)
+		return nil
+	}
+	if err := t.flush(); err != nil {
+		return err
+	}
+	t.pending = buf
+	t.samples = append(t.samples, s)
+	return nil
+}
+
+func (t *avcTrack) flush() error {
+	if t.pending == nil {
+		return nil
+	}
+	err := t.sample(t.pending)
+	t.pending = nil
+	return err
+}
+
+// Ends the track with the last sample, and reads the picture size.
+func (t *avcTrack) close() error {
+	if err := t.flush(); err != nil {
+		return err
+	}
+
+	if t.sps == nil || t.pps == nil {
+		return fmt.Errorf("Remux: no SPS/PPS in the H.264 stream")
+	}
+	if len(t.samples) == 0 {
+		return fmt.Errorf("Remux: no H.264 access units")
+	}
+
+	w, h, err := parseSPS(t.sps)
+	if err != nil {
+		return err
+	}
+	t.width, t.height = w, h
+	return nil
+}
+
+// Splits an Annex B byte stream into NAL units without start codes.
+func splitNALUnits(b []byte) [][]byte {
+	var (
+		out   [][]byte
+		start = -1
+	)
+	for i := 0; i+2 < len(b); i++ {
+		if b[i] != 0 || b[i+1] != 0 || b[i+2] != 1 {
+			continue
+		}
+		if start >= 0 {
+			end := i
+			// 4-byte start code
+			if end > start && b[end-1] == 0 {
+				end--
+			}
+			if end > start {
+				out = append(out, b[start:end])
+			}
+		}
+		start = i + 3
+		i += 2
+	}
+	if start >= 0 && start < len(b) {
+		out = append(out, b[start:])
+	}
+	return out
+}
+
+// Returns the picture size coded in a SPS.
+func parseSPS(nal []byte) (width, height int, err error) {
+	defer func() {
+		if recover() != nil {
+			err = fmt.Errorf("Remux: truncated SPS")
+		}
+	}()
+
+	var (
+		r       = &bitReader{b: unescapeRBSP(nal[1:])}
+		profile = r.u(8)
+		chroma  = 1
+	)
+	r.u(16) // constraint flags & level
+	r.ue()  // seq_parameter_set_id
+
+	switch profile {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		chroma = r.ue()
+		if chroma == 3 {
+			r.u(1) // separate_colour_plane_flag
+		}
+		r.ue() // bit_depth_luma_minus8
+		r.ue() // bit_depth_chroma_minus8
+		r.u(1) // qpprime_y_zero_transform_bypass_flag
+		if r.u(1) == 1 {
+			n := 8
+			if chroma == 3 {
+				n = 12
+			}
+			for i := 0; i < n; i++ {
+				if r.u(1) == 0 {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				last, next := 8, 8
+				for j := 0; j < size && next != 0; j++ {
+					next = (last + r.se() + 256) % 256
+					if next != 0 {
+						last = next
+					}
+				}
+			}
+		}
+	}
+
+	r.ue() // log2_max_frame_num_minus4
+	switch r.ue() {
+	case 0:
+		r.ue() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		r.u(1) // delta_pic_order_always_zero_flag
+		r.se() // offset_for_non_ref_pic
+		r.se() // offset_for_top_to_bottom_field
+		for n := r.ue(); n > 0; n-- {
+			r.se()
+		}
+	}
+	r.ue() // max_num_ref_frames
+	r.u(1) // gaps_in_frame_num_value_allowed_flag
+
+	var (
+		mbWidth   = r.ue() + 1
+		mbHeight  = r.ue() + 1
+		frameOnly = r.u(1)
+	)
+	if frameOnly == 0 {
+		r.u(1) // mb_adaptive_frame_field_flag
+	}
+	r.u(1) // direct_8x8_inference_flag
+
+	width = mbWidth * 16
+	height = (2 - frameOnly) * mbHeight * 16
+
+	if r.u(1) == 1 {
+		var (
+			left, right, top, bottom = r.ue(), r.ue(), r.ue(), r.ue()
+			unitX, unitY             = 1, 2 - frameOnly
+		)
+		switch chroma {
+		case 1:
+			unitX, unitY = 2, 2*(2-frameOnly)
+		case 2:
+			unitX = 2
+		}
+		width -= (left + right) * unitX
+		height -= (top + bottom) * unitY
+	}
+	return width, height, nil
+}
+
+// Removes the emulation prevention bytes (00 00 03).
+func unescapeRBSP(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		if i+2 < len(b) && b[i] == 0 && b[i+1] == 0 && b[i+2] == 3 {
+			out = append(out, 0, 0)
+			i += 2
+			continue
+		}
+		out = append(out, b[i])
+	}
+	return out
+}
+
+// Reads bits and Exp-Golomb codes, panics on the end of data.
+type bitReader struct {
+	b   []byte
+	pos int
+}
+
+func (r *bitReader) u(n int) int {
+	v := 0
+	for i := 0; i < n; i++ {
+		bit := int(r.b[r.pos/8]>>(7-r.pos%8)) & 1
+		v = v<<1 | bit
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) ue() int {
+	zeros := 0
+	for r.u(1) == 0 {
+		zeros++
+	}
+	return 1<<zeros - 1 + r.u(zeros)
+}
+
+func (r *bitReader) se() int {
+	v := r.ue()
+	if v%2 == 0 {
+		return -v / 2
+	}
+	return (v + 1) / 2
+}
@@ -0,0 +1,478 @@
+package remux
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+)
+
+const (
+	movieTimescale = 1000
+	videoTimescale = 90000
+)
+
+// Represents a track ready to be written.
+type track struct {
+	id        int
+	video     bool
+	timescale int
+	// Delay of the first sample to the earliest track, in movie timescale.
+	delay int64
+
+	sampleEntry []byte
+	sizes       []uint32
+	// Decoding durations of the samples
+	durations []uint32
+	// Composition offsets, nil if all zero
+	offsets []uint32
+	// Indexes (1-based) of the sync samples, nil if all the samples are sync samples
+	syncs []uint32
+
+	width, height int
+
+	// The samples are spooled in a temporary file until written in a single chunk, offset is the chunk's position in
+	// the file.
+	spool  *os.File
+	buf    *bufio.Writer
+	offset uint64
+}
+
+// Returns a track spooling its samples into a temporary file, which is removed by close().
+func newTrack() (*track, error) {
+	f, err := os.CreateTemp("", "onsengo-remux-*")
+	if err != nil {
+		return nil, err
+	}
+	return &track{spool: f, buf: bufio.NewWriter(f)}, nil
+}
+
+// Spools the data of the next sample.
+func (t *track) add(data []byte) error {
+	if _, err := t.buf.Write(data); err != nil {
+		return err
+	}
+	t.sizes = append(t.sizes, uint32(len(data)))
+	return nil
+}
+
+// Copies the spooled samples to w.
+func (t *track) writeData(w io.Writer) error {
+	if err := t.buf.Flush(); err != nil {
+		return err
+	}
+	_, err := io.Copy(w, io.NewSectionReader(t.spool, 0, int64(t.dataSize())))
+	return err
+}
+
+// Removes the spooled samples.
+func (t *track) close() {
+	t.spool.Close()
+	os.Remove(t.spool.Name())
+}
+
+func (t *track) duration() uint64 {
+	var d uint64
+	for _, v := range t.durations {
+		d += uint64(v)
+	}
+	return d
+}
+
+func (t *track) dataSize() uint64 {
+	var n uint64
+	for _, s := range t.sizes {
+		n += uint64(s)
+	}
+	return n
+}
+
+// Converts a duration in the track's timescale into movie timescale.
+func (t *track) movieDuration(d uint64) uint64 {
+	return d * movieTimescale / uint64(t.timescale)
+}
+
+// Sets up the track for the frames of a, which are spooled already.
+func (t *track) setAudio(a *aacTrack) {
+	t.timescale = a.sampleRate
+	for range t.sizes {
+		t.durations = append(t.durations, 1024)
+	}
+	t.sampleEntry = mp4a(a)
+}
+
+// Sets up the track for the samples of v, which are spooled already.
+func (t *track) setVideo(v *avcTrack) {
+	t.video = true
+	t.timescale = videoTimescale
+	t.width, t.height = v.width, v.height
+
+	var (
+		n         = len(v.samples)
+		allSync   = true
+		hasOffset = false
+	)
+	for i, s := range v.samples {
+		var d int64
+		switch {
+		case i+1 < n:
+			d = v.samples[i+1].dts - s.dts
+		case i > 0:
+			// The last sample lasts as long as the previous one.
+			d = s.dts - v.samples[i-1].dts
+		default:
+			d = videoTimescale / 30
+		}
+		if d < 0 {
+			d = 0
+		}
+		t.durations = append(t.durations, uint32(d))
+
+		off := s.pts - s.dts
+		if off < 0 {
+			off = 0
+		}
+		hasOffset = hasOffset || off != 0
+		t.offsets = append(t.offsets, uint32(off))
+
+		if s.key {
+			t.syncs = append(t.syncs, uint32(i+1))
+		} else {
+			allSync = false
+		}
+	}
+	if !hasOffset {
+		t.offsets = nil
+	}
+	if allSync {
+		t.syncs = nil
+	}
+
+	t.sampleEntry = avc1(v)
+}
+
+// Writes the whole MP4 file: ftyp, moov and then mdat, so that it can be played progressively. The sample tables in
+// moov need only the sizes and the timing, the samples are copied from the spools afterwards.
+func writeMP4(w io.Writer, tracks []*track, meta Metadata) error {
+	var (
+		video  = false
+		mdatSz uint64
+	)
+	for i, t := range tracks {
+		t.id = i + 1
+		video = video || t.video
+		mdatSz += t.dataSize()
+	}
+
+	var (
+		ftypBox = ftyp(video)
+		large   = mdatSz+8 > math.MaxUint32
+		header  = uint64(8)
+	)
+	if large {
+		header = 16
+	}
+
+	// moov has the same size no matter the offsets, layout once to find out where the samples go.
+	offset := uint64(len(ftypBox)) + uint64(len(moov(tracks, meta, large))) + header
+	for _, t := range tracks {
+		t.offset = offset
+		offset += t.dataSize()
+	}
+
+	out := append(ftypBox, moov(tracks, meta, large)...)
+	if large {
+		out = binary.BigEndian.AppendUint32(out, 1)
+		out = append(out, "mdat"...)
+		out = binary.BigEndian.AppendUint64(out, mdatSz+16)
+	} else {
+		out = binary.BigEndian.AppendUint32(out, uint32(mdatSz+8))
+		out = append(out, "mdat"...)
+	}
+	if _, err := w.Write(out); err != nil {
+		return err
+	}
+	for _, t := range tracks {
+		if err := t.writeData(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ftyp(video bool) []byte {
+	if video {
+		return box("ftyp", []byte("isom"), u32(0x200), []byte("isomiso2avc1mp41"))
+	}
+	return box("ftyp", []byte("M4A "), u32(0), []byte("M4A mp42isom"))
+}
+
+func moov(tracks []*track, meta Metadata, large bool) []byte {
+	var (
+		duration uint64
+		traks    [][]byte
+	)
+	for _, t := range tracks {
+		d := uint64(t.delay) + t.movieDuration(t.duration())
+		if d > duration {
+			duration = d
+		}
+		traks = append(traks, trak(t, large))
+	}
+
+	parts := [][]byte{mvhd(duration, len(tracks)+1)}
+	parts = append(parts, traks...)
+	parts = append(parts, udta(meta))
+	return box("moov", parts...)
+}
+
+func mvhd(duration uint64, next int) []byte {
+	return fullbox("mvhd", 0, 0,
+		u32(0), u32(0), // creation & modification time
+		u32(movieTimescale),
+		u32(uint32(duration)),
+		u32(0x00010000), // rate
+		u16(0x0100),     // volume
+		make([]byte, 10),
+		matrix(),
+		make([]byte, 24),
+		u32(uint32(next)),
+	)
+}
+
+func trak(t *track, large bool) []byte {
+	parts := [][]byte{tkhd(t)}
+	if t.delay > 0 {
+		parts = append(parts, edts(t))
+	}
+	parts = append(parts, mdia(t, large))
+	return box("trak", parts...)
+}
+
+func tkhd(t *track) []byte {
+	volume := uint16(0x0100)
+	if t.video {
+		volume = 0
+	}
+	return fullbox("tkhd", 0, 0x3, // enabled, in movie
+		u32(0), u32(0),
+		u32(uint32(t.id)),
+		u32(0),
+		u32(uint32(uint64(t.delay)+t.movieDuration(t.duration()))),
+		make([]byte, 8),
+		u16(0), u16(0), // layer, alternate group
+		u16(volume),
+		u16(0),
+		matrix(),
+		u32(uint32(t.width)<<16),
+		u32(uint32(t.height)<<16),
+	)
+}
+
+// An empty edit delays the track to keep it in sync with the others.
+func edts(t *track) []byte {
+	return box("edts", fullbox("elst", 0, 0,
+		u32(2),
+		u32(uint32(t.delay)), u32(0xffffffff), u32(0x00010000),
+		u32(uint32(t.movieDuration(t.duration()))), u32(0), u32(0x00010000),
+	))
+}
+
+func mdia(t *track, large bool) []byte {
+	var (
+		handler = "soun"
+		name    = "SoundHandler"
+		header  = fullbox("smhd", 0, 0, u16(0), u16(0))
+	)
+	if t.video {
+		handler, name = "vide", "VideoHandler"
+		header = fullbox("vmhd", 0, 1, u16(0), make([]byte, 6))
+	}
+
+	return box("mdia",
+		fullbox("mdhd", 0, 0,
+			u32(0), u32(0),
+			u32(uint32(t.timescale)),
+			u32(uint32(t.duration())),
+			u16(0x55c4), // "und"
+			u16(0),
+		),
+		hdlr(handler, name),
+		box("minf",
+			header,
+			box("dinf", fullbox("dref", 0, 0, u32(1), fullbox("url ", 0, 1))),
+			stbl(t, large),
+		),
+	)
+}
+
+func hdlr(handler, name string) []byte {
+	return fullbox("hdlr", 0, 0,
+		u32(0),
+		[]byte(handler),
+		make([]byte, 12),
+		append([]byte(name), 0),
+	)
+}
+
+func stbl(t *track, large bool) []byte {
+	parts := [][]byte{
+		fullbox("stsd", 0, 0, u32(1), t.sampleEntry),
+		stts(t.durations),
+	}
+	if t.offsets != nil {
+		parts = append(parts, table("ctts", t.offsets, true))
+	}
+	if t.syncs != nil {
+		parts = append(parts, table("stss", t.syncs, false))
+	}
+	parts = append(parts,
+		// A single chunk of all samples
+		fullbox("stsc", 0, 0, u32(1), u32(1), u32(uint32(len(t.sizes))), u32(1)),
+		fullbox("stsz", 0, 0, u32(0), u32(uint32(len(t.sizes))), u32s(t.sizes)),
+	)
+	if large {
+		parts = append(parts, fullbox("co64", 0, 0, u32(1), u64(t.offset)))
+	} else {
+		parts = append(parts, fullbox("stco", 0, 0, u32(1), u32(uint32(t.offset))))
+	}
+	return box("stbl", parts...)
+}
+
+// Run-length encodes the durations.
+func stts(durations []uint32) []byte {
+	return table("stts", durations, true)
+}
+
+// Writes a table box, either as (count, value) runs or as plain values.
+func table(typ string, values []uint32, runs bool) []byte {
+	if !runs {
+		return fullbox(typ, 0, 0, u32(uint32(len(values))), u32s(values))
+	}
+
+	var (
+		entries []uint32
+		n       int
+	)
+	for i := 0; i < len(values); {
+		j := i
+		for j < len(values) && values[j] == values[i] {
+			j++
+		}
+		entries = append(entries, uint32(j-i), values[i])
+		n++
+		i = j
+	}
+	return fullbox(typ, 0, 0, u32(uint32(n)), u32s(entries))
+}
+
+func mp4a(a *aacTrack) []byte {
+	return box("mp4a",
+		make([]byte, 6), u16(1), // reserved, data reference index
+		make([]byte, 8),
+		u16(uint16(a.channels)),
+		u16(16), // sample size
+		u16(0), u16(0),
+		u32(uint32(a.sampleRate)<<16),
+		esds(a.config),
+	)
+}
+
+func esds(config []byte) []byte {
+	var (
+		dsi = descriptor(0x05, config)
+		dcd = descriptor(0x04, cat(
+			[]byte{0x40, 0x15}, // MPEG-4 audio, audio stream
+			make([]byte, 3),    // buffer size
+			u32(0), u32(0),     // max & average bitrate
+			dsi,
+		))
+		sl = descriptor(0x06, []byte{0x02})
+	)
+	return fullbox("esds", 0, 0, descriptor(0x03, cat(u16(0), []byte{0}, dcd, sl)))
+}
+
+func descriptor(tag byte, body []byte) []byte {
+	n := len(body)
+	return cat(
+		[]byte{tag, 0x80 | byte(n>>21&0x7f), 0x80 | byte(n>>14&0x7f), 0x80 | byte(n>>7&0x7f), byte(n & 0x7f)},
+		body,
+	)
+}
+
+func avc1(v *avcTrack) []byte {
+	return box("avc1",
+		make([]byte, 6), u16(1),
+		make([]byte, 16),
+		u16(uint16(v.width)), u16(uint16(v.height)),
+		u32(0x00480000), u32(0x00480000), // 72 dpi
+		u32(0),
+		u16(1), // frame count
+		make([]byte, 32),
+		u16(0x0018), // depth
+		u16(0xffff),
+		box("avcC",
+			[]byte{1, v.sps[1], v.sps[2], v.sps[3], 0xff, 0xe1},
+			u16(uint16(len(v.sps))), v.sps,
+			[]byte{1},
+			u16(uint16(len(v.pps))), v.pps,
+		),
+	)
+}
+
+// iTunes-style metadata.
+func udta(meta Metadata) []byte {
+	var items [][]byte
+	for _, it := range meta.items() {
+		items = append(items, box(it.key, box("data", u32(1), u32(0), []byte(it.value))))
+	}
+
+	return box("udta",
+		fullbox("meta", 0, 0,
+			fullbox("hdlr", 0, 0, u32(0), []byte("mdir"), []byte("appl"), make([]byte, 9)),
+			box("ilst", items...),
+		),
+	)
+}
+
+func matrix() []byte {
+	return cat(
+		u32(0x00010000), u32(0), u32(0),
+		u32(0), u32(0x00010000), u32(0),
+		u32(0), u32(0), u32(0x40000000),
+	)
+}
+
+func box(typ string, parts ...[]byte) []byte {
+	body := cat(parts...)
+	return cat(u32(uint32(8+len(body))), []byte(typ), body)
+}
+
+func fullbox(typ string, version byte, flags uint32, parts ...[]byte) []byte {
+	return box(typ, append([]byte{version, byte(flags >> 16), byte(flags >> 8), byte(flags)}, cat(parts...)...))
+}
+
+func cat(parts ...[]byte) []byte {
+	var n int
+	for _, p := range parts {
+		n += len(p)
+	}
+	out := make([]byte, 0, n)
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+func u16(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+func u32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+func u64(v uint64) []byte { return binary.BigEndian.AppendUint64(nil, v) }
+
+func u32s(vs []uint32) []byte {
+	out := make([]byte, 0, 4*len(vs))
+	for _, v := range vs {
+		out = binary.BigEndian.AppendUint32(out, v)
+	}
+	return out
+}
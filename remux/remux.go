@@ -0,0 +1,183 @@
+// Package remux converts the downloaded HLS streams into MP4 files without transcoding, so that the episodes can be
+// played and indexed as ordinary .m4a/.mp4 files.
+//
+// Two kinds of input are supported:
+//
+//	MPEG-TS with AAC (ADTS) audio and optionally H.264 video, e.g. the .ts segments
+//	Packed audio: ADTS frames with ID3 tags in between, e.g. the .aac segments
+//
+// Metadata is written into iTunes-style atoms (moov.udta.meta.ilst) which most media servers understand.
+package remux
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// The tags to write. Empty values are omitted.
+type Metadata struct {
+	// ©nam, e.g. the episode title
+	Title string
+	// ©alb, e.g. the radio title
+	Album string
+	// ©ART and aART, e.g. the hosts
+	Artists []string
+	// ©day
+	Date time.Time
+	// ©cmt
+	Comment string
+}
+
+type item struct {
+	key, value string
+}
+
+func (m Metadata) items() []item {
+	var out []item
+
+	add := func(key, value string) {
+		if value != "" {
+			out = append(out, item{key, value})
+		}
+	}
+	add("\xa9nam", m.Title)
+	add("\xa9alb", m.Album)
+	add("\xa9ART", strings.Join(m.Artists, ", "))
+	add("aART", strings.Join(m.Artists, ", "))
+	if !m.Date.IsZero() {
+		add("\xa9day", m.Date.Format("2006-01-02"))
+	}
+	add("\xa9cmt", m.Comment)
+	add("\xa9too", "onsengo")
+
+	return out
+}
+
+// Reads a whole stream from r and writes it as MP4 to w. The output has an audio track, and a video track if the
+// input has H.264 video. As moov goes before the samples, the samples are spooled in temporary files rather than
+// kept in memory.
+func Remux(w io.Writer, r io.Reader, meta Metadata) error {
+	tracks, err := tracksOf(bufio.NewReader(r))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, t := range tracks {
+			t.close()
+		}
+	}()
+
+	return writeMP4(w, tracks, meta)
+}
+
+// Parses the stream into tracks with their samples spooled, which are removed on errors.
+func tracksOf(r *bufio.Reader) (tracks []*track, err error) {
+	var (
+		audio, video *track
+		// The first PTS of the audio
+		audioStart int64
+	)
+	defer func() {
+		if err != nil {
+			for _, t := range []*track{video, audio} {
+				if t != nil {
+					t.close()
+				}
+			}
+		}
+	}()
+
+	if b, _ := r.Peek(1); len(b) > 0 && b[0] != tsSyncByte {
+		if audio, err = newTrack(); err != nil {
+			return nil, err
+		}
+		a := &aacTrack{frame: audio.add}
+		buf := make([]byte, 32*1024)
+		for {
+			n, rerr := r.Read(buf)
+			if err := a.write(buf[:n]); err != nil {
+				return nil, err
+			}
+			if rerr == io.EOF {
+				break
+			}
+			if rerr != nil {
+				return nil, rerr
+			}
+		}
+		if err := a.close(); err != nil {
+			return nil, err
+		}
+		audio.setAudio(a)
+		return []*track{audio}, nil
+	}
+
+	var (
+		a *aacTrack
+		v *avcTrack
+	)
+	err = demux(r, func(typ byte, p pes) error {
+		var err error
+		switch typ {
+		case streamTypeH264:
+			if v == nil {
+				if video, err = newTrack(); err != nil {
+					return err
+				}
+				v = &avcTrack{sample: video.add}
+			}
+			return v.write(p)
+		case streamTypeAAC:
+			if a == nil {
+				if audio, err = newTrack(); err != nil {
+					return err
+				}
+				a = &aacTrack{frame: audio.add}
+				audioStart = p.pts
+			}
+			return a.write(p.payload)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var starts []int64
+	if v != nil {
+		if err := v.close(); err != nil {
+			return nil, err
+		}
+		video.setVideo(v)
+		tracks = append(tracks, video)
+		starts = append(starts, v.samples[0].pts)
+	}
+	if a != nil {
+		if err := a.close(); err != nil {
+			return nil, err
+		}
+		audio.setAudio(a)
+		tracks = append(tracks, audio)
+		starts = append(starts, audioStart)
+	}
+
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("Remux: no supported stream, only AAC and H.264 are supported")
+	}
+
+	// Delay the tracks starting later than the earliest one.
+	earliest := starts[0]
+	for _, s := range starts {
+		if s < earliest {
+			earliest = s
+		}
+	}
+	for i, t := range tracks {
+		t.delay = (starts[i] - earliest) * movieTimescale / 90000
+	}
+
+	return tracks, nil
+}
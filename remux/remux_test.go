@@ -0,0 +1,456 @@
+package remux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	pidPMT   = 0x1000
+	pidVideo = 0x100
+	pidAudio = 0x101
+	// Listed after pidAudio
+	pidAudio2 = 0x102
+)
+
+// Returns an ADTS frame of AAC-LC, 48kHz, stereo.
+func adtsFrame(payload []byte) []byte {
+	n := 7 + len(payload)
+	return append([]byte{
+		0xff, 0xf1,
+		1<<6 | 3<<2 | 0,
+		2<<6 | byte(n>>11),
+		byte(n >> 3),
+		byte(n&0x7)<<5 | 0x1f,
+		0xfc,
+	}, payload...)
+}
+
+// Returns a SPS of a 640x360 baseline stream, coded as 640x368 with cropping.
+func sps() []byte {
+	w := &bitWriter{}
+	w.u(8, 66)   // profile_idc
+	w.u(8, 0xc0) // constraint flags
+	w.u(8, 30)   // level_idc
+	w.ue(0)      // seq_parameter_set_id
+	w.ue(0)      // log2_max_frame_num_minus4
+	w.ue(2)      // pic_order_cnt_type
+	w.ue(1)      // max_num_ref_frames
+	w.u(1, 0)    // gaps_in_frame_num_value_allowed_flag
+	w.ue(39)     // pic_width_in_mbs_minus1
+	w.ue(22)     // pic_height_in_map_units_minus1
+	w.u(1, 1)    // frame_mbs_only_flag
+	w.u(1, 1)    // direct_8x8_inference_flag
+	w.u(1, 1)    // frame_cropping_flag
+	w.ue(0)
+	w.ue(0)
+	w.ue(0)
+	w.ue(4)
+	w.u(1, 0) // vui_parameters_present_flag
+	w.u(1, 1) // rbsp_stop_one_bit
+	return append([]byte{0x67}, w.bytes()...)
+}
+
+type bitWriter struct {
+	bits []byte
+}
+
+func (w *bitWriter) u(n int, v int) {
+	for i := n - 1; i >= 0; i-- {
+		w.bits = append(w.bits, byte(v>>i&1))
+	}
+}
+
+func (w *bitWriter) ue(v int) {
+	v++
+	n := 0
+	for x := v; x > 1; x >>= 1 {
+		n++
+	}
+	w.u(n, 0)
+	w.u(n+1, v)
+}
+
+func (w *bitWriter) bytes() []byte {
+	out := make([]byte, (len(w.bits)+7)/8)
+	for i, b := range w.bits {
+		out[i/8] |= b << (7 - i%8)
+	}
+	return out
+}
+
+// A minimal MPEG-TS muxer for the tests.
+type tsMuxer struct {
+	buf bytes.Buffer
+}
+
+func (m *tsMuxer) psi(pid int, section []byte) {
+	m.packets(pid, append([]byte{0}, section...))
+}
+
+func (m *tsMuxer) pat() {
+	sec := []byte{0x00, 0xb0, 13, 0, 1, 0xc1, 0, 0, 0, 1, 0xe0 | pidPMT>>8, pidPMT & 0xff, 0, 0, 0, 0}
+	m.psi(0, sec)
+}
+
+func (m *tsMuxer) pmt(types map[int]byte) {
+	var es []byte
+	for _, pid := range []int{pidVideo, pidAudio, pidAudio2} {
+		if typ, ok := types[pid]; ok {
+			es = append(es, typ, 0xe0|byte(pid>>8), byte(pid), 0xf0, 0)
+		}
+	}
+	n := 9 + len(es) + 4
+	sec := append([]byte{0x02, 0xb0, byte(n), 0, 1, 0xc1, 0, 0, 0xe1, 0x00, 0xf0, 0}, es...)
+	m.psi(pidPMT, append(sec, 0, 0, 0, 0))
+}
+
+func (m *tsMuxer) pes(pid int, streamId byte, pts, dts int64, payload []byte) {
+	var header []byte
+	if pts == dts {
+		header = append([]byte{0x80, 0x80, 5}, timestamp(0x2, pts)...)
+	} else {
+		header = append([]byte{0x80, 0xc0, 10}, timestamp(0x3, pts)...)
+		header = append(header, timestamp(0x1, dts)...)
+	}
+	b := append([]byte{0, 0, 1, streamId, 0, 0}, header...)
+	b = append(b, payload...)
+	if streamId != 0xe0 {
+		binary.BigEndian.PutUint16(b[4:], uint16(len(b)-6))
+	}
+	m.packets(pid, b)
+}
+
+// Splits a payload into TS packets, the last one is stuffed by an adaptation field.
+func (m *tsMuxer) packets(pid int, b []byte) {
+	for first := true; len(b) > 0; first = false {
+		h := []byte{0x47, byte(pid >> 8), byte(pid), 0x10}
+		if first {
+			h[1] |= 0x40
+		}
+
+		n := len(b)
+		if n >= 184 {
+			m.buf.Write(h)
+			m.buf.Write(b[:184])
+			b = b[184:]
+			continue
+		}
+
+		h[3] = 0x30
+		stuff := 184 - n - 1
+		m.buf.Write(h)
+		m.buf.WriteByte(byte(stuff))
+		if stuff > 0 {
+			m.buf.WriteByte(0)
+			m.buf.Write(bytes.Repeat([]byte{0xff}, stuff-1))
+		}
+		m.buf.Write(b)
+		b = nil
+	}
+}
+
+func timestamp(prefix byte, ts int64) []byte {
+	return []byte{
+		prefix<<4 | byte(ts>>29)&0x0e | 1,
+		byte(ts >> 22),
+		byte(ts>>14)&0xfe | 1,
+		byte(ts >> 7),
+		byte(ts<<1)&0xfe | 1,
+	}
+}
+
+// Returns the body of the box at the path, nil if not found.
+func find(b []byte, path ...string) []byte {
+	for len(b) >= 8 {
+		size := int(binary.BigEndian.Uint32(b))
+		if size < 8 || size > len(b) {
+			return nil
+		}
+		if string(b[4:8]) != path[0] {
+			b = b[size:]
+			continue
+		}
+
+		body := b[8:size]
+		if len(path) == 1 {
+			return body
+		}
+		switch path[0] {
+		case "meta":
+			body = body[4:]
+		case "stsd":
+			body = body[8:]
+		case "mp4a":
+			body = body[28:]
+		case "avc1":
+			body = body[78:]
+		}
+		return find(body, path[1:]...)
+	}
+	return nil
+}
+
+func all(b []byte, typ string) [][]byte {
+	var out [][]byte
+	for len(b) >= 8 {
+		size := int(binary.BigEndian.Uint32(b))
+		if string(b[4:8]) == typ {
+			out = append(out, b[8:size])
+		}
+		b = b[size:]
+	}
+	return out
+}
+
+var meta = Metadata{
+	Title:   "第83回 予告",
+	Album:   "藤田茜シーズン1",
+	Artists: []string{"藤田茜"},
+	Date:    time.Date(2021, 4, 9, 0, 0, 0, 0, time.FixedZone("UTC+9", 9*60*60)),
+	Comment: "ゲスト: 日高里菜",
+}
+
+func TestRemuxAudio(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		m      = &tsMuxer{}
+		frames []byte
+	)
+
+	m.pat()
+	m.pmt(map[int]byte{pidAudio: streamTypeAAC})
+	for i := 0; i < 3; i++ {
+		// 2 frames a PES, the second frame spans two PES packets.
+		var es []byte
+		es = append(es, adtsFrame(bytes.Repeat([]byte{byte(i)}, 200))...)
+		es = append(es, adtsFrame(bytes.Repeat([]byte{byte(i + 10)}, 300))...)
+		m.pes(pidAudio, 0xc0, int64(i)*3840, int64(i)*3840, es[:len(es)-100])
+		m.pes(pidAudio, 0xc0, int64(i)*3840+1920, int64(i)*3840+1920, es[len(es)-100:])
+
+		frames = append(frames, bytes.Repeat([]byte{byte(i)}, 200)...)
+		frames = append(frames, bytes.Repeat([]byte{byte(i + 10)}, 300)...)
+	}
+
+	var out bytes.Buffer
+	assert.NoError(Remux(&out, bytes.NewReader(m.buf.Bytes()), meta))
+
+	b := out.Bytes()
+	assert.Equal("M4A ", string(find(b, "ftyp")[:4]))
+	assert.Len(all(find(b, "moov"), "trak"), 1)
+
+	stbl := find(b, "moov", "trak", "mdia", "minf", "stbl")
+	assert.Equal(uint32(6), binary.BigEndian.Uint32(find(stbl, "stsz")[8:]))
+	// AudioSpecificConfig: AAC-LC, 48kHz, stereo
+	assert.True(bytes.Contains(find(stbl, "stsd", "mp4a", "esds"), []byte{0x05, 0x80, 0x80, 0x80, 2, 0x11, 0x90}))
+	assert.Nil(find(stbl, "stss"))
+
+	mdhd := find(b, "moov", "trak", "mdia", "mdhd")
+	assert.Equal(uint32(48000), binary.BigEndian.Uint32(mdhd[12:]))
+	assert.Equal(uint32(6*1024), binary.BigEndian.Uint32(mdhd[16:]))
+
+	// The samples are the frames without ADTS headers, right after the offset in stco.
+	off := binary.BigEndian.Uint32(find(stbl, "stco")[8:])
+	assert.Equal(frames, b[off:off+uint32(len(frames))])
+	assert.Equal(frames, find(b, "mdat"))
+
+	ilst := find(b, "moov", "udta", "meta", "ilst")
+	tags := map[string]string{}
+	for _, key := range []string{"\xa9nam", "\xa9alb", "\xa9ART", "aART", "\xa9day", "\xa9cmt", "\xa9too"} {
+		if data := find(ilst, key, "data"); data != nil {
+			tags[key] = string(data[8:])
+		}
+	}
+	assert.Equal(map[string]string{
+		"\xa9nam": "第83回 予告",
+		"\xa9alb": "藤田茜シーズン1",
+		"\xa9ART": "藤田茜",
+		"aART":    "藤田茜",
+		"\xa9day": "2021-04-09",
+		"\xa9cmt": "ゲスト: 日高里菜",
+		"\xa9too": "onsengo",
+	}, tags)
+}
+
+func TestRemuxVideo(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		m      = &tsMuxer{}
+		pps    = []byte{0x68, 0xce, 0x38, 0x80}
+	)
+
+	m.pat()
+	m.pmt(map[int]byte{pidVideo: streamTypeH264, pidAudio: streamTypeAAC})
+	for i := 0; i < 4; i++ {
+		var (
+			au  = []byte{0, 0, 0, 1, 0x09, 0xf0}
+			dts = int64(9000 + i*3000)
+			pts = dts + 3000
+		)
+		if i%2 == 0 {
+			au = append(au, 0, 0, 0, 1)
+			au = append(au, sps()...)
+			au = append(au, 0, 0, 0, 1)
+			au = append(au, pps...)
+			au = append(au, 0, 0, 1, 0x65, 0x88, 0x80)
+		} else {
+			au = append(au, 0, 0, 1, 0x41, 0x9a, 0x02)
+		}
+		m.pes(pidVideo, 0xe0, pts, dts, au)
+	}
+	// Audio starts 100ms later than video.
+	m.pes(pidAudio, 0xc0, 12000+9000, 12000+9000, append(adtsFrame([]byte{1}), adtsFrame([]byte{2})...))
+
+	var out bytes.Buffer
+	assert.NoError(Remux(&out, bytes.NewReader(m.buf.Bytes()), Metadata{}))
+
+	var (
+		b     = out.Bytes()
+		traks = all(find(b, "moov"), "trak")
+	)
+	assert.Equal("isom", string(find(b, "ftyp")[:4]))
+	assert.Len(traks, 2)
+
+	video := find(traks[0], "mdia", "minf", "stbl")
+	avc1 := find(video, "stsd", "avc1")
+	assert.Equal(uint16(640), binary.BigEndian.Uint16(avc1[24:]))
+	assert.Equal(uint16(360), binary.BigEndian.Uint16(avc1[26:]))
+
+	avcC := find(video, "stsd", "avc1", "avcC")
+	assert.Equal([]byte{1, 66, 0xc0, 30}, avcC[:4])
+	assert.Equal(sps(), avcC[8:8+len(sps())])
+
+	assert.Equal(uint32(4), binary.BigEndian.Uint32(find(video, "stsz")[8:]))
+	assert.Equal(append(u32(2), append(u32(1), u32(3)...)...), find(video, "stss")[4:])
+	assert.Equal(append(u32(1), append(u32(4), u32(3000)...)...), find(video, "ctts")[4:])
+	assert.Equal(append(u32(1), append(u32(4), u32(3000)...)...), find(video, "stts")[4:])
+
+	// Samples are length-prefixed without AUD & parameter sets.
+	off := binary.BigEndian.Uint32(find(video, "stco")[8:])
+	assert.Equal([]byte{0, 0, 0, 3, 0x65, 0x88, 0x80}, b[off:off+7])
+
+	// Audio track is delayed by an empty edit.
+	elst := find(traks[1], "edts", "elst")
+	assert.Equal(uint32(100), binary.BigEndian.Uint32(elst[8:]))
+	assert.Equal(uint32(0xffffffff), binary.BigEndian.Uint32(elst[12:]))
+	assert.Nil(find(traks[0], "edts"))
+}
+
+func TestRemuxPackedAudio(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		id3    = append([]byte("ID3\x04\x00\x00\x00\x00\x00\x05"), "xxxxx"...)
+		in     []byte
+	)
+	for i := 0; i < 2; i++ {
+		in = append(in, id3...)
+		in = append(in, adtsFrame([]byte{byte(i)})...)
+		in = append(in, adtsFrame([]byte{byte(i + 10)})...)
+	}
+
+	var out bytes.Buffer
+	assert.NoError(Remux(&out, bytes.NewReader(in), Metadata{}))
+	assert.Equal([]byte{0, 10, 1, 11}, find(out.Bytes(), "mdat"))
+}
+
+func TestRemuxFirstStream(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		m      = &tsMuxer{}
+	)
+
+	m.pat()
+	m.pmt(map[int]byte{pidAudio: streamTypeAAC, pidAudio2: streamTypeAAC})
+	m.pes(pidAudio2, 0xc1, 0, 0, adtsFrame([]byte{2}))
+	m.pes(pidAudio, 0xc0, 0, 0, adtsFrame([]byte{1}))
+
+	// The first stream in the PMT is taken, every time.
+	for i := 0; i < 20; i++ {
+		var out bytes.Buffer
+		assert.NoError(Remux(&out, bytes.NewReader(m.buf.Bytes()), Metadata{}))
+		assert.Equal([]byte{1}, find(out.Bytes(), "mdat"))
+	}
+}
+
+func TestRemuxSpool(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		tmp    = t.TempDir()
+		m      = &tsMuxer{}
+	)
+	t.Setenv("TMPDIR", tmp)
+
+	m.pat()
+	m.pmt(map[int]byte{pidAudio: streamTypeAAC})
+	m.pes(pidAudio, 0xc0, 0, 0, append(adtsFrame([]byte{1}), adtsFrame([]byte{2})...))
+
+	// The spools are removed after the samples are written, or on errors.
+	var out bytes.Buffer
+	assert.NoError(Remux(&out, bytes.NewReader(m.buf.Bytes()), Metadata{}))
+	assert.Equal([]byte{1, 2}, find(out.Bytes(), "mdat"))
+	assert.Error(Remux(&bytes.Buffer{}, strings.NewReader("not an aac"), Metadata{}))
+
+	des, err := os.ReadDir(tmp)
+	assert.NoError(err)
+	assert.Empty(des)
+}
+
+func TestRemuxResync(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		in     []byte
+		// A syncword with a frame length shorter than the header
+		corrupt = []byte{0xff, 0xf1, 0x4c, 0x80, 0x00, 0x1f, 0xfc}
+	)
+	in = append(in, adtsFrame([]byte{1})...)
+	in = append(in, 0x00)
+	in = append(in, adtsFrame([]byte{2})...)
+	in = append(in, corrupt...)
+	in = append(in, adtsFrame([]byte{3})...)
+
+	// Garbage and corrupted headers are skipped, the frames after them are kept.
+	var out bytes.Buffer
+	assert.NoError(Remux(&out, bytes.NewReader(in), Metadata{}))
+	assert.Equal([]byte{1, 2, 3}, find(out.Bytes(), "mdat"))
+
+	err := Remux(&bytes.Buffer{}, bytes.NewReader(append(in, corrupt...)), Metadata{})
+	assert.EqualError(err, "Remux: lost ADTS sync, no frame in the last 7 bytes")
+}
+
+func TestRemuxErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	{
+		m := &tsMuxer{}
+		m.pat()
+		m.pmt(map[int]byte{pidAudio: 0x03})
+		m.pes(pidAudio, 0xc0, 0, 0, []byte{1, 2, 3})
+
+		err := Remux(&bytes.Buffer{}, bytes.NewReader(m.buf.Bytes()), Metadata{})
+		assert.EqualError(err, "Remux: no supported stream, only AAC and H.264 are supported")
+	}
+	{
+		err := Remux(&bytes.Buffer{}, strings.NewReader("not an aac"), Metadata{})
+		assert.EqualError(err, "Remux: no ADTS frames")
+	}
+	{
+		err := Remux(&bytes.Buffer{}, strings.NewReader("\x47"+strings.Repeat("\x00", 187)+"\x00"+strings.Repeat("\x00", 187)), Metadata{})
+		assert.EqualError(err, "Remux: lost sync at offset 188")
+	}
+}
+
+func TestParseSPS(t *testing.T) {
+	w, h, err := parseSPS(sps())
+	assert.NoError(t, err)
+	assert.Equal(t, 640, w)
+	assert.Equal(t, 360, h)
+
+	_, _, err = parseSPS([]byte{0x67, 66})
+	assert.EqualError(t, err, "Remux: truncated SPS")
+}
@@ -0,0 +1,206 @@
+package remux
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+
+	streamTypeAAC  = 0x0f
+	streamTypeH264 = 0x1b
+)
+
+// Represents a PES packet of an elementary stream.
+type pes struct {
+	pts, dts int64
+	// Whether the PES header carries a PTS
+	timed   bool
+	payload []byte
+}
+
+// Demuxes MPEG-TS read from r, fn is called with each PES packet of the elementary streams and their stream types.
+// Only the first program, and the first stream of each type in it, is taken.
+func demux(r io.Reader, fn func(typ byte, p pes) error) error {
+	var (
+		pmt     = -1
+		streams = make(map[int]byte)
+		// PES packets being reassembled by PIDs
+		pending = make(map[int]*bytes.Buffer)
+		pkt     = make([]byte, tsPacketSize)
+	)
+
+	flush := func(pid int) error {
+		buf, ok := pending[pid]
+		if !ok || buf.Len() == 0 {
+			return nil
+		}
+		pending[pid] = new(bytes.Buffer)
+		if p, ok := parsePES(buf.Bytes()); ok {
+			return fn(streams[pid], p)
+		}
+		return nil
+	}
+
+	for off := 0; ; off += tsPacketSize {
+		if _, err := io.ReadFull(r, pkt); err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if pkt[0] != tsSyncByte {
+			return fmt.Errorf("Remux: lost sync at offset %d", off)
+		}
+
+		var (
+			pusi    = pkt[1]&0x40 != 0
+			pid     = int(pkt[1]&0x1f)<<8 | int(pkt[2])
+			afc     = (pkt[3] >> 4) & 0x3
+			payload = pkt[4:]
+		)
+
+		switch afc {
+		case 0x1:
+		case 0x3:
+			n := int(payload[0])
+			if n+1 > len(payload) {
+				continue
+			}
+			payload = payload[n+1:]
+		default:
+			// Adaptation field only, or reserved
+			continue
+		}
+
+		switch {
+		case pid == 0:
+			if pmt < 0 {
+				pmt = parsePAT(psiSection(payload, pusi))
+			}
+		case pid == pmt:
+			if len(streams) == 0 {
+				taken := make(map[byte]bool)
+				for _, es := range parsePMT(psiSection(payload, pusi)) {
+					if !taken[es.typ] {
+						taken[es.typ] = true
+						streams[es.pid] = es.typ
+						pending[es.pid] = new(bytes.Buffer)
+					}
+				}
+			}
+		default:
+			if _, ok := streams[pid]; !ok {
+				continue
+			}
+			if pusi {
+				if err := flush(pid); err != nil {
+					return err
+				}
+			}
+			pending[pid].Write(payload)
+		}
+	}
+	for pid := range pending {
+		if err := flush(pid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the section of a PSI payload, skipping the pointer field.
+func psiSection(payload []byte, pusi bool) []byte {
+	if !pusi || len(payload) == 0 {
+		return nil
+	}
+	n := int(payload[0])
+	if n+1 > len(payload) {
+		return nil
+	}
+	return payload[n+1:]
+}
+
+// Returns the PMT PID of the first program, -1 if not found.
+func parsePAT(sec []byte) int {
+	if len(sec) < 8 {
+		return -1
+	}
+	end := 3 + (int(sec[1]&0x0f)<<8 | int(sec[2])) - 4 // without CRC32
+	for i := 8; i+4 <= end && i+4 <= len(sec); i += 4 {
+		program := int(sec[i])<<8 | int(sec[i+1])
+		if program == 0 {
+			// Network PID
+			continue
+		}
+		return int(sec[i+2]&0x1f)<<8 | int(sec[i+3])
+	}
+	return -1
+}
+
+// An elementary stream listed in a PMT.
+type esInfo struct {
+	pid int
+	typ byte
+}
+
+// Returns the elementary streams in the order of the PMT.
+func parsePMT(sec []byte) []esInfo {
+	var out []esInfo
+	if len(sec) < 12 {
+		return out
+	}
+
+	var (
+		end  = 3 + (int(sec[1]&0x0f)<<8 | int(sec[2])) - 4 // without CRC32
+		info = int(sec[10]&0x0f)<<8 | int(sec[11])
+	)
+	for i := 12 + info; i+5 <= end && i+5 <= len(sec); {
+		var (
+			typ = sec[i]
+			pid = int(sec[i+1]&0x1f)<<8 | int(sec[i+2])
+			n   = int(sec[i+3]&0x0f)<<8 | int(sec[i+4])
+		)
+		out = append(out, esInfo{pid, typ})
+		i += 5 + n
+	}
+	return out
+}
+
+// Parses a PES packet, ok is false if it's not a valid one.
+func parsePES(b []byte) (p pes, ok bool) {
+	if len(b) < 9 || b[0] != 0 || b[1] != 0 || b[2] != 1 {
+		return pes{}, false
+	}
+
+	var (
+		flags = b[7] >> 6
+		n     = int(b[8])
+	)
+	if 9+n > len(b) {
+		return pes{}, false
+	}
+
+	if flags&0x2 != 0 && n >= 5 {
+		p.pts = parseTimestamp(b[9:])
+		p.dts = p.pts
+		p.timed = true
+	}
+	if flags == 0x3 && n >= 10 {
+		p.dts = parseTimestamp(b[14:])
+	}
+
+	p.payload = b[9+n:]
+	return p, true
+}
+
+// Parses a 33-bit PTS/DTS.
+func parseTimestamp(b []byte) int64 {
+	return int64(b[0]>>1&0x07)<<30 |
+		int64(b[1])<<22 |
+		int64(b[2]>>1)<<15 |
+		int64(b[3])<<7 |
+		int64(b[4]>>1)
+}
@@ -0,0 +1,155 @@
+// Package session keeps the session of onsen.ag in a file, readable only by the user, and optionally encrypted with a
+// passphrase.
+//
+// The file is in JSON, with the session in plain text:
+//
+//	{"session": "SESSION"}
+//
+// or encrypted by AES-256-GCM with a key derived from the passphrase by PBKDF2-SHA256:
+//
+//	{"kdf": "pbkdf2-sha256", "iterations": 600000, "salt": "...", "nonce": "...", "ciphertext": "..."}
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	KDF = "pbkdf2-sha256"
+	// The iterations of PBKDF2 for new files, as recommended by OWASP for PBKDF2-HMAC-SHA256
+	Iterations = 600000
+)
+
+// Returned by Load() when the passphrase doesn't decrypt the file.
+var ErrPassphrase = errors.New("wrong passphrase")
+
+// The content of a session file.
+type File struct {
+	Session string `json:"session,omitempty"`
+
+	// for encrypted files
+	KDF        string `json:"kdf,omitempty"`
+	Iterations int    `json:"iterations,omitempty"`
+	Salt       []byte `json:"salt,omitempty"`
+	Nonce      []byte `json:"nonce,omitempty"`
+	Ciphertext []byte `json:"ciphertext,omitempty"`
+}
+
+func (f File) IsEncrypted() bool {
+	return f.KDF != ""
+}
+
+// Saves the session to the file with the permission 0600, encrypted if the passphrase is not empty. The directory is
+// created with 0700 if it doesn't exist.
+func Save(path, session, passphrase string) error {
+	f := File{Session: session}
+	if passphrase != "" {
+		var err error
+		if f, err = encrypt(session, passphrase); err != nil {
+			return err
+		}
+	}
+
+	b, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Reads the file without decrypting it.
+func Read(path string) (File, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return File{}, err
+	}
+
+	var f File
+	if err := json.Unmarshal(b, &f); err != nil {
+		return File{}, fmt.Errorf("Read: %s: %w", path, err)
+	}
+	if f.IsEncrypted() && f.KDF != KDF {
+		return File{}, fmt.Errorf("Read: %s: unknown kdf %q", path, f.KDF)
+	}
+	return f, nil
+}
+
+// Returns the session in the file. The passphrase is asked for only if the file is encrypted.
+func Load(path string, passphrase func() (string, error)) (string, error) {
+	f, err := Read(path)
+	if err != nil {
+		return "", err
+	}
+	if !f.IsEncrypted() {
+		return f.Session, nil
+	}
+
+	p, err := passphrase()
+	if err != nil {
+		return "", err
+	}
+	return decrypt(f, p)
+}
+
+func key(passphrase string, salt []byte, iter int) []byte {
+	return pbkdf2.Key([]byte(passphrase), salt, iter, 32, sha256.New)
+}
+
+func encrypt(session, passphrase string) (File, error) {
+	f := File{KDF: KDF, Iterations: Iterations, Salt: make([]byte, 16)}
+	if _, err := rand.Read(f.Salt); err != nil {
+		return File{}, err
+	}
+
+	gcm, err := newGCM(key(passphrase, f.Salt, f.Iterations))
+	if err != nil {
+		return File{}, err
+	}
+	f.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return File{}, err
+	}
+	f.Ciphertext = gcm.Seal(nil, f.Nonce, []byte(session), nil)
+	return f, nil
+}
+
+func decrypt(f File, passphrase string) (string, error) {
+	gcm, err := newGCM(key(passphrase, f.Salt, f.Iterations))
+	if err != nil {
+		return "", err
+	}
+	if len(f.Nonce) != gcm.NonceSize() {
+		return "", fmt.Errorf("decrypt: invalid nonce")
+	}
+	b, err := gcm.Open(nil, f.Nonce, f.Ciphertext, nil)
+	if err != nil {
+		return "", ErrPassphrase
+	}
+	return string(b), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
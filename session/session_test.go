@@ -0,0 +1,72 @@
+package session
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSession(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		path   = filepath.Join(t.TempDir(), "onsengo", "session.json")
+		asked  = 0
+		ask    = func(p string) func() (string, error) {
+			return func() (string, error) {
+				asked++
+				return p, nil
+			}
+		}
+	)
+
+	_, err := Load(path, ask(""))
+	assert.True(errors.Is(err, fs.ErrNotExist))
+
+	// Plain
+	assert.NoError(Save(path, "SESSION", ""))
+	{
+		fi, _ := os.Stat(path)
+		assert.Equal(os.FileMode(0600), fi.Mode().Perm())
+		di, _ := os.Stat(filepath.Dir(path))
+		assert.Equal(os.FileMode(0700), di.Mode().Perm())
+
+		s, err := Load(path, ask(""))
+		assert.NoError(err)
+		assert.Equal("SESSION", s)
+		assert.Equal(0, asked, "no passphrase for a plain file")
+	}
+
+	// Encrypted
+	assert.NoError(Save(path, "SESSION", "secret"))
+	{
+		b, _ := os.ReadFile(path)
+		assert.NotContains(string(b), "SESSION")
+		assert.True(strings.HasPrefix(string(b), `{"kdf":"pbkdf2-sha256","iterations":600000,`))
+
+		f, err := Read(path)
+		assert.NoError(err)
+		assert.True(f.IsEncrypted())
+
+		s, err := Load(path, ask("secret"))
+		assert.NoError(err)
+		assert.Equal("SESSION", s)
+		assert.Equal(1, asked)
+
+		_, err = Load(path, ask("wrong"))
+		assert.Equal(ErrPassphrase, err)
+
+		// Tampered
+		f.Ciphertext[0] ^= 1
+		_, err = decrypt(f, "secret")
+		assert.Equal(ErrPassphrase, err)
+	}
+
+	os.WriteFile(path, []byte(`{"kdf":"scrypt"}`), 0600)
+	_, err = Read(path)
+	assert.EqualError(err, "Read: "+path+`: unknown kdf "scrypt"`)
+}
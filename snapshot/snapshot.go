@@ -0,0 +1,137 @@
+// Package snapshot stores the raw data of onsen.ag over time, to tell what changed between runs.
+//
+// A store is a plain directory of the raw data, as returned by onsen.RawData(), each in a JSON file named after the
+// time it was taken in UTC:
+//
+//	~/.local/share/onsengo/snapshots
+//	├── 20211029T010000Z.json
+//	└── 20211030T010000Z.json
+//
+// The raw data is kept rather than the decoded one, so that later versions can decode more from old snapshots.
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adios/onsengo/onsen"
+)
+
+// The time layout of snapshot names.
+const Layout = "20060102T150405Z"
+
+// Represents a snapshot in a store.
+type Snapshot struct {
+	// The file name without ".json"
+	Name    string
+	Path    string
+	TakenAt time.Time
+}
+
+type Store struct {
+	dir string
+}
+
+// Opens the store at dir, the directory is created if it doesn't exist. Raw data of a session has the user's data, so
+// the directory and the snapshots are accessible by the user only.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Saves the raw data taken at the time. The file is written only if the data is valid JSON, and a snapshot of the
+// same second is replaced.
+func (s *Store) Save(raw string, at time.Time) (Snapshot, error) {
+	if !json.Valid([]byte(raw)) {
+		return Snapshot{}, fmt.Errorf("Save: invalid JSON")
+	}
+
+	sn := s.snapshot(at.UTC().Truncate(time.Second))
+	tmp := sn.Path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(raw), 0600); err != nil {
+		return Snapshot{}, err
+	}
+	if err := os.Rename(tmp, sn.Path); err != nil {
+		return Snapshot{}, err
+	}
+	return sn, nil
+}
+
+// Returns all the snapshots in ascending order on the time taken, files not named after Layout are ignored.
+func (s *Store) List() ([]Snapshot, error) {
+	des, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []Snapshot{}
+	for _, de := range des {
+		name := strings.TrimSuffix(de.Name(), ".json")
+		if de.IsDir() || name == de.Name() {
+			continue
+		}
+		tm, err := time.Parse(Layout, name)
+		if err != nil {
+			continue
+		}
+		out = append(out, s.snapshot(tm))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].TakenAt.Before(out[j].TakenAt) })
+	return out, nil
+}
+
+// Returns the latest snapshot, otherwise ok is set to false.
+func (s *Store) Latest() (sn Snapshot, ok bool, err error) {
+	ss, err := s.List()
+	if err != nil || len(ss) == 0 {
+		return Snapshot{}, false, err
+	}
+	return ss[len(ss)-1], true, nil
+}
+
+// Returns the snapshot of the name, with or without ".json".
+func (s *Store) Get(name string) (Snapshot, error) {
+	tm, err := time.Parse(Layout, strings.TrimSuffix(name, ".json"))
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("Get: %s: not a snapshot name", name)
+	}
+	sn := s.snapshot(tm)
+	if _, err := os.Stat(sn.Path); err != nil {
+		return Snapshot{}, fmt.Errorf("Get: %s: not found", name)
+	}
+	return sn, nil
+}
+
+func (s *Store) snapshot(tm time.Time) Snapshot {
+	name := tm.Format(Layout)
+	return Snapshot{Name: name, Path: filepath.Join(s.dir, name+".json"), TakenAt: tm}
+}
+
+// Decodes the snapshot into an Onsen.
+func (sn Snapshot) Load() (*onsen.Onsen, error) {
+	return Load(sn.Path)
+}
+
+// Decodes a file of the raw data into an Onsen, the file is not necessarily in a store.
+func Load(path string) (*onsen.Onsen, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	o, err := onsen.CreateFromRawData(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("Load: %s: %w", path, err)
+	}
+	return o, nil
+}
@@ -0,0 +1,80 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		dir    = filepath.Join(t.TempDir(), "snapshots")
+		raw, _ = os.ReadFile("../onsen/testdata/fixture_nologin_screened.json")
+		jst    = time.FixedZone("UTC+9", 9*60*60)
+	)
+
+	s, err := Open(dir)
+	assert.NoError(err)
+	{
+		ss, err := s.List()
+		assert.NoError(err)
+		assert.Empty(ss)
+		_, ok, err := s.Latest()
+		assert.NoError(err)
+		assert.False(ok)
+	}
+
+	_, err = s.Save("{", time.Now())
+	assert.EqualError(err, "Save: invalid JSON")
+
+	a, err := s.Save(string(raw), time.Date(2021, 10, 30, 10, 0, 0, 500, jst))
+	assert.NoError(err)
+	assert.Equal("20211030T010000Z", a.Name)
+	assert.Equal(filepath.Join(dir, "20211030T010000Z.json"), a.Path)
+	if fi, err := os.Stat(dir); assert.NoError(err) {
+		assert.Equal(os.FileMode(0700), fi.Mode().Perm())
+	}
+	if fi, err := os.Stat(a.Path); assert.NoError(err) {
+		assert.Equal(os.FileMode(0600), fi.Mode().Perm())
+	}
+
+	b, err := s.Save(string(raw), time.Date(2021, 10, 29, 10, 0, 0, 0, jst))
+	assert.NoError(err)
+
+	// Ignored
+	os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0644)
+	os.WriteFile(filepath.Join(dir, "notes.json"), nil, 0644)
+
+	{
+		ss, err := s.List()
+		assert.NoError(err)
+		assert.Equal([]Snapshot{b, a}, ss)
+
+		sn, ok, err := s.Latest()
+		assert.NoError(err)
+		assert.True(ok)
+		assert.Equal(a, sn)
+	}
+	{
+		sn, err := s.Get("20211029T010000Z.json")
+		assert.NoError(err)
+		assert.Equal(b, sn)
+
+		_, err = s.Get("20211028T010000Z")
+		assert.EqualError(err, "Get: 20211028T010000Z: not found")
+		_, err = s.Get("yesterday")
+		assert.EqualError(err, "Get: yesterday: not a snapshot name")
+	}
+	{
+		o, err := a.Load()
+		assert.NoError(err)
+		assert.Len(o.Radios(), 141)
+
+		_, err = Load(filepath.Join(dir, "notes.json"))
+		assert.Error(err)
+	}
+}